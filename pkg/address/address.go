@@ -0,0 +1,166 @@
+// address.go
+package address
+
+import (
+	"crypto/sha256"
+	"encoding/base64"
+	"errors"
+	"fmt"
+	"strings"
+)
+
+//===
+//bech32 (BIP173) encoding of cosmos addresses, e.g. cosmos1... or osmo1...
+
+const bech32Charset = "qpzry9x8gf2tvdw0s3jn54khce6mua7l"
+
+var bech32Gen = [5]uint32{0x3b6a57b2, 0x26508e6d, 0x1ea119fa, 0x3d4233dd, 0x2a1462b3}
+
+func bech32Polymod(values []byte) uint32 {
+	chk := uint32(1)
+	for _, v := range values {
+		top := chk >> 25
+		chk = (chk&0x1ffffff)<<5 ^ uint32(v)
+		for i := 0; i < 5; i++ {
+			if (top>>uint(i))&1 == 1 {
+				chk ^= bech32Gen[i]
+			}
+		}
+	}
+	return chk
+}
+
+func bech32HrpExpand(hrp string) []byte {
+	ret := make([]byte, 0, 2*len(hrp)+1)
+	for i := 0; i < len(hrp); i++ {
+		ret = append(ret, hrp[i]>>5)
+	}
+	ret = append(ret, 0)
+	for i := 0; i < len(hrp); i++ {
+		ret = append(ret, hrp[i]&31)
+	}
+	return ret
+}
+
+// regroups bits, e.g. 8 bit bytes to 5 bit bech32 groups and back
+func convertBits(data []byte, fromBits, toBits uint, pad bool) ([]byte, error) {
+	var acc uint32
+	var nBits uint
+	var ret []byte
+	maxV := uint32(1)<<toBits - 1
+
+	for _, v := range data {
+		if uint32(v)>>fromBits != 0 {
+			return nil, errors.New("invalid data range")
+		}
+		acc = acc<<fromBits | uint32(v)
+		nBits += fromBits
+		for nBits >= toBits {
+			nBits -= toBits
+			ret = append(ret, byte(acc>>nBits&maxV))
+		}
+	}
+	if pad {
+		if nBits > 0 {
+			ret = append(ret, byte(acc<<(toBits-nBits)&maxV))
+		}
+	} else if nBits >= fromBits || acc<<(toBits-nBits)&maxV != 0 {
+		return nil, errors.New("invalid padding")
+	}
+	return ret, nil
+}
+
+// encodes the address bytes with the given prefix (hrp)
+func Encode(hrp string, addrBytes []byte) (string, error) {
+	data, err := convertBits(addrBytes, 8, 5, true)
+	if err != nil {
+		return "", err
+	}
+
+	values := append(bech32HrpExpand(hrp), data...)
+	polymod := bech32Polymod(append(values, 0, 0, 0, 0, 0, 0)) ^ 1
+
+	var sb strings.Builder
+	sb.WriteString(hrp + "1")
+	for _, d := range data {
+		sb.WriteByte(bech32Charset[d])
+	}
+	for i := 0; i < 6; i++ {
+		sb.WriteByte(bech32Charset[(polymod>>uint(5*(5-i)))&31])
+	}
+	return sb.String(), nil
+}
+
+// decodes an address into its prefix (hrp) and bytes, checks the checksum.
+// No length limit of 90 chars, as cosmos addresses of 32 bytes (contracts, ica) are longer.
+func Decode(addr string) (string, []byte, error) {
+	if strings.ToLower(addr) != addr && strings.ToUpper(addr) != addr {
+		return "", nil, fmt.Errorf("mixed case in address '%s'", addr)
+	}
+	addr = strings.ToLower(addr)
+
+	pos := strings.LastIndex(addr, "1")
+	if pos < 1 || pos+7 > len(addr) {
+		return "", nil, fmt.Errorf("invalid separator position in address '%s'", addr)
+	}
+	hrp := addr[:pos]
+	for i := 0; i < len(hrp); i++ {
+		if hrp[i] < 33 || hrp[i] > 126 {
+			return "", nil, fmt.Errorf("invalid character in prefix of address '%s'", addr)
+		}
+	}
+
+	data := make([]byte, 0, len(addr)-pos-1)
+	for _, c := range addr[pos+1:] {
+		idx := strings.IndexRune(bech32Charset, c)
+		if idx < 0 {
+			return "", nil, fmt.Errorf("invalid character '%c' in address '%s'", c, addr)
+		}
+		data = append(data, byte(idx))
+	}
+
+	if bech32Polymod(append(bech32HrpExpand(hrp), data...)) != 1 {
+		return "", nil, fmt.Errorf("invalid checksum of address '%s'", addr)
+	}
+
+	addrBytes, err := convertBits(data[:len(data)-6], 5, 8, false)
+	if err != nil {
+		return "", nil, fmt.Errorf("invalid address '%s': %w", addr, err)
+	}
+	return hrp, addrBytes, nil
+}
+
+// the prefix (hrp) of a valid address, e.g. cosmos for cosmos1...
+func Prefix(addr string) (string, error) {
+	hrp, _, err := Decode(addr)
+	return hrp, err
+}
+
+//===
+//account addresses from public keys
+
+// address of a secp256k1 public key (base64 of the 33 byte compressed key, as in addr.yaml and the txs' signer_infos):
+// bech32(hrp, ripemd160(sha256(pubKey)))
+func FromPubKey(pubKeyB64 string, hrp string) (string, error) {
+	pubKey, err := base64.StdEncoding.DecodeString(pubKeyB64)
+	if err != nil {
+		return "", fmt.Errorf("invalid base64 pubkey '%s': %w", pubKeyB64, err)
+	}
+	if len(pubKey) != 33 {
+		return "", fmt.Errorf("pubkey '%s' is not a compressed secp256k1 key (%v bytes)", pubKeyB64, len(pubKey))
+	}
+
+	sha := sha256.Sum256(pubKey)
+	rmd := ripemd160(sha[:])
+	return Encode(hrp, rmd[:])
+}
+
+// true if the pubkey belongs to the address (same derivation as FromPubKey, prefix taken from the address)
+func MatchesPubKey(addr string, pubKeyB64 string) bool {
+	hrp, err := Prefix(addr)
+	if err != nil {
+		return false
+	}
+	derived, err := FromPubKey(pubKeyB64, hrp)
+	return err == nil && derived == strings.ToLower(addr)
+}
@@ -0,0 +1,104 @@
+package address
+
+import (
+	"encoding/hex"
+	"strings"
+	"testing"
+)
+
+// the reference vectors of the RIPEMD-160 authors
+func TestRipemd160(t *testing.T) {
+	tests := []struct {
+		in   string
+		want string
+	}{
+		{"", "9c1185a5c5e9fc54612808977ee8f548b2258d31"},
+		{"a", "0bdc9d2d256b3ee9daae347be6f4dc835a467ffe"},
+		{"abc", "8eb208f7e05d987a9b044a8e98c6b087f15a0bfc"},
+		{"message digest", "5d0689ef49d2fae572b881b123a85ffa21595f36"},
+		{"abcdefghijklmnopqrstuvwxyz", "f71c27109c692c1b56bbdceb5b9d2865b3708dbc"},
+		{"abcdbcdecdefdefgefghfghighijhijkijkljklmklmnlmnomnopnopq", "12a053384a9c0c88e405a06c27dcf49ada62eb2b"},
+		{"ABCDEFGHIJKLMNOPQRSTUVWXYZabcdefghijklmnopqrstuvwxyz0123456789", "b0e20b6e3116640286ed3a87a5713079b21f5189"},
+		{strings.Repeat("1234567890", 8), "9b752e45573d4b39f4dbd3323cab82bf63326bfb"},
+		{strings.Repeat("a", 1000000), "52783243c1697bdbe16d37f97f68f08325dc1528"},
+	}
+
+	for _, tt := range tests {
+		digest := ripemd160([]byte(tt.in))
+		if got := hex.EncodeToString(digest[:]); got != tt.want {
+			t.Errorf("ripemd160(%.20q) = %s, want %s", tt.in, got, tt.want)
+		}
+	}
+}
+
+// the valid bech32 strings of BIP-173
+func TestDecodeValid(t *testing.T) {
+	tests := []struct {
+		addr string
+		hrp  string
+	}{
+		{"A12UEL5L", "a"},
+		{"a12uel5l", "a"},
+		{"an83characterlonghumanreadablepartthatcontainsthenumber1andtheexcludedcharactersbio1tt5tgs", "an83characterlonghumanreadablepartthatcontainsthenumber1andtheexcludedcharactersbio"},
+		{"abcdef1qpzry9x8gf2tvdw0s3jn54khce6mua7lmqqqxw", "abcdef"},
+		{"11qqqqqqqqqqqqqqqqqqqqqqqqqqqqqqqqqqqqqqqqqqqqqqqqqqqqqqqqqqqqqqqqqqqqqqqqqqqqqqqqqqc8247j", "1"},
+		{"?1ezyfcl", "?"},
+	}
+
+	for _, tt := range tests {
+		hrp, _, err := Decode(tt.addr)
+		if err != nil || hrp != tt.hrp {
+			t.Errorf("Decode(%s) = %s, %v; want prefix %s", tt.addr, hrp, err, tt.hrp)
+		}
+	}
+}
+
+// the invalid bech32 strings of BIP-173, except the one over 90 chars: cosmos addresses of 32 bytes are longer
+func TestDecodeInvalid(t *testing.T) {
+	tests := []string{
+		"\x201nwldj5",  //hrp character out of range
+		"\x7f1axkwrx",  //hrp character out of range
+		"\x801eym55h",  //hrp character out of range
+		"pzry9x0s0muk", //no separator
+		"1pzry9x0s0muk",
+		"x1b4n0q5v", //invalid data character
+		"li1dgmt3",  //too short checksum
+		"de1lg7wt\xff",
+		"A1G7SGD8", //checksum calculated with the upper case hrp
+		"10a06t8",  //empty hrp
+		"1qzzfhee",
+		"cosmos1W508d6qejxtdg4y5r3zarvary0c5xw7k6ah60c", //mixed case
+	}
+
+	for _, addr := range tests {
+		if _, _, err := Decode(addr); err == nil {
+			t.Errorf("Decode(%q) succeeded, want an error", addr)
+		}
+	}
+}
+
+// the secp256k1 generator point as pubkey: its hash160 is the one of BIP-173's P2WPKH example
+const testPubKey = "Anm+Zn753LusVaBilc6HCwcCm/zbLc4o2VnygVsW+BeY"
+
+func TestFromPubKey(t *testing.T) {
+	addr, err := FromPubKey(testPubKey, "cosmos")
+	if err != nil || addr != "cosmos1w508d6qejxtdg4y5r3zarvary0c5xw7k6ah60c" {
+		t.Fatalf("FromPubKey() = %s, %v", addr, err)
+	}
+
+	hrp, addrBytes, err := Decode(addr)
+	if err != nil || hrp != "cosmos" || hex.EncodeToString(addrBytes) != "751e76e8199196d454941c45d1b3a323f1433bd6" {
+		t.Errorf("Decode(%s) = %s, %x, %v", addr, hrp, addrBytes, err)
+	}
+
+	osmoAddr, err := Encode("osmo", addrBytes)
+	if err != nil || !MatchesPubKey(osmoAddr, testPubKey) {
+		t.Errorf("pubkey does not match %s (%v)", osmoAddr, err)
+	}
+	if MatchesPubKey("cosmos1ycv7ag92g3v4gmd7fsf9jjsz527qwpr3cd8pqn", testPubKey) {
+		t.Error("pubkey matches an other address")
+	}
+	if _, err := FromPubKey("AQID", "cosmos"); err == nil {
+		t.Error("want an error for a pubkey that is not 33 bytes")
+	}
+}
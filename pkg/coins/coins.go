@@ -0,0 +1,210 @@
+// coins.go
+package coins
+
+import (
+	"fmt"
+	"math/big"
+	"regexp"
+	"strings"
+)
+
+// one amount of a denom as found in events, e.g. 12uatom or 3ibc/27394FB0...
+type Coin struct {
+	Amount string //integer (or decimal for DecCoins) in base units
+	Denom  string
+}
+
+// amount followed by the denom, see sdk's coin regex: denoms start with a letter followed by letters, digits or /:._-
+var reCoin = regexp.MustCompile(`^([0-9]+(?:\.[0-9]+)?)([a-zA-Z][a-zA-Z0-9/:._-]{1,127})$`)
+
+// parses sdk.Coins strings like 12uatom,3ibc/27394FB092D2ECCD56123C74F36E4C1F926001CEADA9CA97EA622B25F41E5EB2,5factory/osmo1.../token
+func ParseCoins(s string) ([]Coin, error) {
+	var coins []Coin
+
+	s = strings.TrimSpace(s)
+	if s == "" {
+		return coins, nil
+	}
+
+	for _, sCoin := range strings.Split(s, ",") {
+		match := reCoin.FindStringSubmatch(strings.TrimSpace(sCoin))
+		if match == nil {
+			return nil, fmt.Errorf("invalid coin: '%s' in '%s'", sCoin, s)
+		}
+		coins = append(coins, Coin{Amount: match[1], Denom: match[2]})
+	}
+
+	return coins, nil
+}
+
+//===
+//exact decimal amounts: token amounts (up to 18 decimals) and their fiat values are kept exact from parsing to the csv,
+//only the fiat values are rounded (if configured)
+
+// exact decimal number; the zero value is 0. Dec values are immutable (operations return a new Dec), so copies can be shared.
+type Dec struct {
+	rat *big.Rat
+}
+
+// parses a decimal string like 123, 0.01577100 or 1e-8
+func NewDecFromString(s string) (Dec, error) {
+	rat, ok := new(big.Rat).SetString(strings.TrimSpace(s))
+	if !ok {
+		return Dec{}, fmt.Errorf("invalid decimal: '%s'", s)
+	}
+	return Dec{rat: rat}, nil
+}
+
+// amount in base units (e.g. 1523456 uatom) shifted by exponent (-> 1.523456 atom)
+func NewDecFromBaseUnits(amount string, exponent int) (Dec, error) {
+	d, err := NewDecFromString(amount)
+	if err != nil {
+		return d, err
+	}
+	return d.Shift(-exponent), nil
+}
+
+func (d Dec) get() *big.Rat {
+	if d.rat == nil {
+		return new(big.Rat)
+	}
+	return d.rat
+}
+
+func (d Dec) Add(o Dec) Dec {
+	return Dec{rat: new(big.Rat).Add(d.get(), o.get())}
+}
+
+func (d Dec) Sub(o Dec) Dec {
+	return Dec{rat: new(big.Rat).Sub(d.get(), o.get())}
+}
+
+func (d Dec) Mul(o Dec) Dec {
+	return Dec{rat: new(big.Rat).Mul(d.get(), o.get())}
+}
+
+// d * 10^n
+func (d Dec) Shift(n int) Dec {
+	pow := new(big.Int).Exp(big.NewInt(10), big.NewInt(int64(abs(n))), nil)
+	fact := new(big.Rat).SetInt(pow)
+	if n < 0 {
+		fact.Inv(fact)
+	}
+	return d.Mul(Dec{rat: fact})
+}
+
+func (d Dec) IsZero() bool {
+	return d.get().Sign() == 0
+}
+
+// -1, 0 or +1
+func (d Dec) Sign() int {
+	return d.get().Sign()
+}
+
+// rounds to the given number of decimals (halves away from zero)
+func (d Dec) Round(decimals int) Dec {
+	rounded, _ := NewDecFromString(d.get().FloatString(decimals))
+	return rounded
+}
+
+// the exact decimal representation without trailing zeros; values which are not finite decimals
+// (can only come from divisions, which we don't do) are cut at 36 decimals
+func (d Dec) String() string {
+	rat := d.get()
+	if rat.IsInt() {
+		return rat.Num().String()
+	}
+
+	//a fraction is a finite decimal if its denominator is 2^a*5^b, it then needs max(a,b) decimals
+	denom := new(big.Int).Set(rat.Denom())
+	rem := new(big.Int)
+	nDecimals := 0
+	for _, p := range []int64{2, 5} {
+		n := 0
+		bigP := big.NewInt(p)
+		for {
+			quo, mod := new(big.Int).QuoRem(denom, bigP, rem)
+			if mod.Sign() != 0 {
+				break
+			}
+			denom = quo
+			n++
+		}
+		if n > nDecimals {
+			nDecimals = n
+		}
+	}
+	if denom.Cmp(big.NewInt(1)) != 0 {
+		nDecimals = 36
+	}
+
+	s := rat.FloatString(nDecimals)
+	if strings.Contains(s, ".") {
+		s = strings.TrimRight(strings.TrimRight(s, "0"), ".")
+	}
+	return s
+}
+
+// splits the integer amount (e.g. a fee in base units) into integer parts proportional to the weights, which add up
+// to the amount exactly: the parts are rounded down, the remaining units go one each to the first parts with a weight.
+// If all weights are 0, the amount is split evenly.
+func Split(amount Dec, weights []Dec) []Dec {
+	parts := make([]Dec, len(weights))
+	if len(weights) == 0 {
+		return parts
+	}
+
+	total := new(big.Rat)
+	for _, w := range weights {
+		total.Add(total, w.get())
+	}
+	if total.Sign() == 0 {
+		weights = make([]Dec, len(weights))
+		for i := range weights {
+			weights[i] = Dec{rat: big.NewRat(1, 1)}
+		}
+		total.SetInt64(int64(len(weights)))
+	}
+
+	rest := new(big.Int).Quo(amount.get().Num(), amount.get().Denom()) //amount is expected to be an integer
+	for i, w := range weights {
+		share := new(big.Rat).Mul(amount.get(), w.get())
+		share.Quo(share, total)
+		part := new(big.Int).Quo(share.Num(), share.Denom()) //round down (amounts are positive)
+		parts[i] = Dec{rat: new(big.Rat).SetInt(part)}
+		rest.Sub(rest, part)
+	}
+	//the rest is less than the number of parts with a weight
+	for i := 0; rest.Sign() > 0; i = (i + 1) % len(parts) {
+		if weights[i].get().Sign() <= 0 {
+			continue
+		}
+		parts[i] = parts[i].Add(Dec{rat: big.NewRat(1, 1)})
+		rest.Sub(rest, big.NewInt(1))
+	}
+
+	return parts
+}
+
+// for the csv output (gocsv.TypeMarshaller)
+func (d Dec) MarshalCSV() (string, error) {
+	return d.String(), nil
+}
+
+// for reading csv files (gocsv.TypeUnmarshaller)
+func (d *Dec) UnmarshalCSV(s string) error {
+	dec, err := NewDecFromString(s)
+	if err != nil {
+		return err
+	}
+	*d = dec
+	return nil
+}
+
+func abs(n int) int {
+	if n < 0 {
+		return -n
+	}
+	return n
+}
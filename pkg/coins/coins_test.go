@@ -0,0 +1,174 @@
+package coins
+
+import (
+	"strings"
+	"testing"
+)
+
+const ibcDenom = "ibc/27394FB092D2ECCD56123C74F36E4C1F926001CEADA9CA97EA622B25F41E5EB2"
+const factoryDenom = "factory/osmo1z0qrq605sjgcqpylfl4m0y7sm6d7ne7gkqvtf4/stake.osmo"
+
+func dec(t *testing.T, s string) Dec {
+	d, err := NewDecFromString(s)
+	if err != nil {
+		t.Fatal(err)
+	}
+	return d
+}
+
+func TestParseCoins(t *testing.T) {
+	tests := []struct {
+		in      string
+		want    []Coin
+		wantErr bool
+	}{
+		{"", nil, false},
+		{"  ", nil, false},
+		{"12uatom", []Coin{{"12", "uatom"}}, false},
+		{"12uatom, 5uosmo", []Coin{{"12", "uatom"}, {"5", "uosmo"}}, false},
+		{"3" + ibcDenom + ",7" + factoryDenom, []Coin{{"3", ibcDenom}, {"7", factoryDenom}}, false},
+		{"1000000000000000000aevmos", []Coin{{"1000000000000000000", "aevmos"}}, false}, //18 decimals
+		{"0.123456789012345678uatom", []Coin{{"0.123456789012345678", "uatom"}}, false}, //DecCoins
+		{"12", nil, true},
+		{"uatom", nil, true},
+		{"12u", nil, true},      //denoms have at least 2 characters
+		{"-12uatom", nil, true}, //negative
+		{"12uatom,", nil, true},
+		{"12 uatom", nil, true},
+	}
+
+	for _, tt := range tests {
+		got, err := ParseCoins(tt.in)
+		if (err != nil) != tt.wantErr {
+			t.Errorf("ParseCoins(%q) err = %v, want an error: %v", tt.in, err, tt.wantErr)
+			continue
+		}
+		if len(got) != len(tt.want) {
+			t.Errorf("ParseCoins(%q) = %v, want %v", tt.in, got, tt.want)
+			continue
+		}
+		for i := range got {
+			if got[i] != tt.want[i] {
+				t.Errorf("ParseCoins(%q) = %v, want %v", tt.in, got, tt.want)
+				break
+			}
+		}
+	}
+}
+
+func TestDecString(t *testing.T) {
+	tests := []struct {
+		in   string
+		want string
+	}{
+		{"0", "0"},
+		{"123", "123"},
+		{"0.01577100", "0.015771"},
+		{"1e-8", "0.00000001"},
+		{"-2.50", "-2.5"},
+		{"1/3", "0.333333333333333333333333333333333333"}, //not a finite decimal: cut at 36 decimals
+	}
+
+	for _, tt := range tests {
+		if got := dec(t, tt.in).String(); got != tt.want {
+			t.Errorf("Dec(%s).String() = %s, want %s", tt.in, got, tt.want)
+		}
+	}
+	if got := (Dec{}).String(); got != "0" {
+		t.Errorf("zero value: %s, want 0", got)
+	}
+}
+
+func TestNewDecFromBaseUnits(t *testing.T) {
+	tests := []struct {
+		amount   string
+		exponent int
+		want     string
+	}{
+		{"1523456", 6, "1.523456"},
+		{"1", 18, "0.000000000000000001"},
+		{"123456789012345678901234567890", 18, "123456789012.34567890123456789"},
+		{"5", 0, "5"},
+	}
+
+	for _, tt := range tests {
+		got, err := NewDecFromBaseUnits(tt.amount, tt.exponent)
+		if err != nil || got.String() != tt.want {
+			t.Errorf("NewDecFromBaseUnits(%s, %d) = %s, %v; want %s", tt.amount, tt.exponent, got, err, tt.want)
+		}
+	}
+}
+
+func TestDecRound(t *testing.T) {
+	tests := []struct {
+		in       string
+		decimals int
+		want     string
+	}{
+		//halves away from zero
+		{"0.5", 0, "1"},
+		{"-0.5", 0, "-1"},
+		{"2.5", 0, "3"},
+		{"1.005", 2, "1.01"},
+		{"-1.005", 2, "-1.01"},
+		{"1.00499999", 2, "1"},
+		{"12.3456", 2, "12.35"},
+		{"0.000000000000000001", 18, "0.000000000000000001"},
+		{"0.0000000000000000015", 18, "0.000000000000000002"},
+		{"0.0000000000000000015", 2, "0"},
+		{"123456789.123456789123456789", 8, "123456789.12345679"},
+		{"7", 2, "7"},
+	}
+
+	for _, tt := range tests {
+		if got := dec(t, tt.in).Round(tt.decimals).String(); got != tt.want {
+			t.Errorf("Dec(%s).Round(%d) = %s, want %s", tt.in, tt.decimals, got, tt.want)
+		}
+	}
+}
+
+func TestSplit(t *testing.T) {
+	tests := []struct {
+		name    string
+		amount  string
+		weights []string
+		want    []string
+	}{
+		{"none", "100", nil, nil},
+		{"one", "100", []string{"3"}, []string{"100"}},
+		{"even", "100", []string{"1", "1", "1"}, []string{"34", "33", "33"}},
+		{"even, exact", "99", []string{"1", "1", "1"}, []string{"33", "33", "33"}},
+		{"proportional", "1000", []string{"1", "2", "7"}, []string{"100", "200", "700"}},
+		{"proportional, rest", "10", []string{"1", "1", "1.5"}, []string{"3", "3", "4"}},
+		{"zero weight gets nothing", "7", []string{"0", "1", "1"}, []string{"0", "4", "3"}},
+		{"first only", "7", []string{"1", "0", "0"}, []string{"7", "0", "0"}},
+		{"all zero: even", "7", []string{"0", "0"}, []string{"4", "3"}},
+		{"18 decimal weights", "1000000000000000001", []string{"0.000000000000000001", "0.000000000000000002"},
+			[]string{"333333333333333334", "666666666666666667"}},
+		{"18 decimal amount", "123456789012345678901", []string{"1", "1", "1", "1"},
+			[]string{"30864197253086419726", "30864197253086419725", "30864197253086419725", "30864197253086419725"}},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			var weights []Dec
+			for _, w := range tt.weights {
+				weights = append(weights, dec(t, w))
+			}
+
+			parts := Split(dec(t, tt.amount), weights)
+			var got []string
+			sum := Dec{}
+			for _, part := range parts {
+				got = append(got, part.String())
+				sum = sum.Add(part)
+			}
+			if strings.Join(got, " ") != strings.Join(tt.want, " ") {
+				t.Errorf("Split(%s, %v) = %v, want %v", tt.amount, tt.weights, got, tt.want)
+			}
+			if len(parts) > 0 && sum.String() != tt.amount {
+				t.Errorf("parts add up to %s, want %s", sum, tt.amount)
+			}
+		})
+	}
+}
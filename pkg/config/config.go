@@ -2,9 +2,12 @@
 package config
 
 import (
+	"alexp/stakingtax/pkg/address"
 	"alexp/stakingtax/pkg/configData"
 	"alexp/stakingtax/pkg/utils"
 
+	"bytes"
+	"log"
 	"os"
 
 	"gopkg.in/yaml.v3"
@@ -44,6 +47,146 @@ func GetAddrFromFile(configPathFile string, cfgAdr *configData.CfgAdr) {
 	err = d.Decode(cfgAdr)
 	utils.ErrDefaultFatal(err) //on err log.Fatal with details
 
+	//--- a typo in an address would only show up as empty query results -> check the bech32 checksum
+	tFailed := false
+	for _, network := range cfgAdr.Addresses {
+		for _, addrEntry := range network.AddrList {
+			_, _, err = address.Decode(addrEntry.Addr)
+			if err != nil {
+				log.Println("[WARN] " + network.ChainName + ": " + err.Error())
+				tFailed = true
+			}
+		}
+	}
+	if tFailed {
+		log.Fatal("Invalid addresses in " + configPathFile + ". " + utils.FatalDetails())
+	}
+
+}
+
+//merges the entries into the address file (created if missing): new addresses are appended to their network's addrList,
+//a missing pubKey of an existing address is filled in. Works on the yaml nodes to keep the file's comments.
+func MergeAddrsIntoFile(addrPathFile string, entries []configData.AddrEntry) {
+	var nAdded, nUpdated int
+	doc := &yaml.Node{}
+
+	data, err := os.ReadFile(addrPathFile)
+	if err != nil && !os.IsNotExist(err) {
+		utils.ErrDefaultFatal(err) //on err log.Fatal with details
+	}
+	if len(data) == 0 {
+		data = []byte("#config file for staking tax: tax relevant addresses\n#add an entry for each address\naddresses:\n")
+	}
+	err = yaml.Unmarshal(data, doc)
+	utils.ErrDefaultFatal(err) //on err log.Fatal with details
+	if len(doc.Content) == 0 {
+		//only comments or whitespace: no node to keep the comments at -> add the root mapping to the text
+		data = append(data, "\naddresses:\n"...)
+		err = yaml.Unmarshal(data, doc)
+		utils.ErrDefaultFatal(err) //on err log.Fatal with details
+	}
+	if root := doc.Content[0]; root.Kind != yaml.MappingNode {
+		if root.Tag != "!!null" {
+			log.Println("[W] " + addrPathFile + " holds no mapping -> replaced by one with the addresses")
+		}
+		*root = yaml.Node{Kind: yaml.MappingNode, HeadComment: root.HeadComment, FootComment: root.FootComment}
+	}
+	root := doc.Content[0]
+	networks := yamlMapValue(root, "addresses")
+	if networks == nil {
+		networks = yamlSetMapValue(root, "addresses", &yaml.Node{Kind: yaml.SequenceNode})
+	} else if networks.Kind != yaml.SequenceNode {
+		*networks = yaml.Node{Kind: yaml.SequenceNode}
+	}
+
+	for _, entry := range entries {
+		//--- the network's entry
+		var network *yaml.Node
+		for _, n := range networks.Content {
+			if chainName := yamlMapValue(n, "chainName"); chainName != nil && chainName.Value == entry.ChainName {
+				network = n
+				break
+			}
+		}
+		if network == nil {
+			network = &yaml.Node{Kind: yaml.MappingNode}
+			yamlSetMapValue(network, "chainName", yamlScalar(entry.ChainName))
+			networks.Content = append(networks.Content, network)
+		}
+		addrList := yamlMapValue(network, "addrList")
+		if addrList == nil {
+			addrList = yamlSetMapValue(network, "addrList", &yaml.Node{Kind: yaml.SequenceNode})
+		} else if addrList.Kind != yaml.SequenceNode {
+			*addrList = yaml.Node{Kind: yaml.SequenceNode}
+		}
+
+		//--- the address: new one or fill in the pubKey
+		var addrNode *yaml.Node
+		for _, a := range addrList.Content {
+			if addr := yamlMapValue(a, "addr"); addr != nil && addr.Value == entry.Addr {
+				addrNode = a
+				break
+			}
+		}
+		if addrNode == nil {
+			addrNode = &yaml.Node{Kind: yaml.MappingNode}
+			yamlSetMapValue(addrNode, "addr", yamlScalar(entry.Addr))
+			if entry.PubKey != "" {
+				yamlSetMapValue(addrNode, "pubKey", yamlScalar(entry.PubKey))
+			}
+			addrList.Content = append(addrList.Content, addrNode)
+			nAdded++
+			continue
+		}
+
+		pubKey := yamlMapValue(addrNode, "pubKey")
+		switch {
+		case entry.PubKey == "" || (pubKey != nil && pubKey.Value == entry.PubKey):
+		case pubKey == nil || pubKey.Value == "" || pubKey.Value == "yourPubKey":
+			yamlSetMapValue(addrNode, "pubKey", yamlScalar(entry.PubKey))
+			nUpdated++
+		default:
+			log.Println("[W] " + entry.Addr + ": pubKey in " + addrPathFile + " differs from the keyring's " + entry.PubKey + " -> kept, it is verified on the next run")
+		}
+	}
+
+	//--- write back
+	var buf bytes.Buffer
+	enc := yaml.NewEncoder(&buf)
+	enc.SetIndent(2)
+	err = enc.Encode(doc)
+	utils.ErrDefaultFatal(err) //on err log.Fatal with details
+	err = os.WriteFile(addrPathFile, buf.Bytes(), 0644)
+	utils.ErrDefaultFatal(err) //on err log.Fatal with details
+
+	log.Printf("[OK] %v: %v addresses added, %v pubKeys filled in, %v already present\n", addrPathFile, nAdded, nUpdated, len(entries)-nAdded-nUpdated)
+}
+
+//value node of key in a yaml mapping node, nil if not present
+func yamlMapValue(node *yaml.Node, key string) *yaml.Node {
+	if node.Kind != yaml.MappingNode {
+		return nil
+	}
+	for i := 0; i+1 < len(node.Content); i += 2 {
+		if node.Content[i].Value == key {
+			return node.Content[i+1]
+		}
+	}
+	return nil
+}
+
+//sets (or adds) the value of key in a yaml mapping node, returns the value node
+func yamlSetMapValue(node *yaml.Node, key string, value *yaml.Node) *yaml.Node {
+	if old := yamlMapValue(node, key); old != nil {
+		old.Kind, old.Tag, old.Value, old.Content = value.Kind, value.Tag, value.Value, value.Content
+		return old
+	}
+	node.Content = append(node.Content, yamlScalar(key), value)
+	return value
+}
+
+func yamlScalar(value string) *yaml.Node {
+	return &yaml.Node{Kind: yaml.ScalarNode, Tag: "!!str", Value: value}
 }
 
 //
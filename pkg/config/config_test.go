@@ -0,0 +1,79 @@
+package config
+
+import (
+	"alexp/stakingtax/pkg/configData"
+	"io"
+	"log"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+)
+
+// merges the entries into an addr.yaml with the given content; returns the file written and the addresses read from it
+func mergeAddrs(t *testing.T, content string, entries []configData.AddrEntry) (string, *configData.CfgAdr) {
+	addrPathFile := filepath.Join(t.TempDir(), "addr.yaml")
+	err := os.WriteFile(addrPathFile, []byte(content), 0644)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	log.SetOutput(io.Discard)
+	defer log.SetOutput(os.Stderr)
+	MergeAddrsIntoFile(addrPathFile, entries)
+
+	data, err := os.ReadFile(addrPathFile)
+	if err != nil {
+		t.Fatal(err)
+	}
+	cfgAdr := &configData.CfgAdr{}
+	GetAddrFromFile(addrPathFile, cfgAdr)
+	return string(data), cfgAdr
+}
+
+func TestMergeAddrsIntoFile(t *testing.T) {
+	const cosmosAddr = "cosmos1ycv7ag92g3v4gmd7fsf9jjsz527qwpr3cd8pqn"
+	const osmoAddr = "osmo1ycv7ag92g3v4gmd7fsf9jjsz527qwpr3sk53kp"
+	const pubKey = "AjoFxQuwZr7GkdGz5ZqLaXpyUqH93RuHiY1kGw3XXs74"
+	entries := []configData.AddrEntry{
+		{ChainName: "cosmoshub", Addr: cosmosAddr, PubKey: pubKey},
+		{ChainName: "osmosis", Addr: osmoAddr, PubKey: pubKey},
+	}
+
+	tests := []struct {
+		name        string
+		content     string
+		wantComment string //kept in the file
+		wantNAddrs  map[string]int
+	}{
+		{"empty file", "", "", map[string]int{"cosmoshub": 1, "osmosis": 1}},
+		{"whitespace only", "\n  \n", "", map[string]int{"cosmoshub": 1, "osmosis": 1}},
+		{"comments only", "#my addresses\n#more to come\n", "#my addresses", map[string]int{"cosmoshub": 1, "osmosis": 1}},
+		{"empty document", "#my addresses\n---\n", "#my addresses", map[string]int{"cosmoshub": 1, "osmosis": 1}},
+		{"existing entries", "#my addresses\naddresses:\n  - chainName: cosmoshub #the hub\n    addrList:\n      - addr: cosmos1w508d6qejxtdg4y5r3zarvary0c5xw7k6ah60c\n      - addr: " + cosmosAddr + "\n        pubKey: yourPubKey\n",
+			"#the hub", map[string]int{"cosmoshub": 2, "osmosis": 1}},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			content, cfgAdr := mergeAddrs(t, tt.content, entries)
+			if !strings.Contains(content, tt.wantComment) {
+				t.Errorf("comment %q lost:\n%s", tt.wantComment, content)
+			}
+
+			if len(cfgAdr.Addresses) != len(tt.wantNAddrs) {
+				t.Fatalf("%d networks, want %d:\n%s", len(cfgAdr.Addresses), len(tt.wantNAddrs), content)
+			}
+			for _, network := range cfgAdr.Addresses {
+				if len(network.AddrList) != tt.wantNAddrs[network.ChainName] {
+					t.Errorf("%s: %d addresses, want %d", network.ChainName, len(network.AddrList), tt.wantNAddrs[network.ChainName])
+				}
+				for _, a := range network.AddrList {
+					if (a.Addr == cosmosAddr || a.Addr == osmoAddr) && a.PubKey != pubKey {
+						t.Errorf("%s: pubKey %q, want %s", a.Addr, a.PubKey, pubKey)
+					}
+				}
+			}
+		})
+	}
+}
@@ -10,6 +10,21 @@ type TradePairs4TaxType struct {
 	Pairs    []string `yaml:"pairs"`
 }
 
+//a node with the (full or partial) history of a network, to backfill heights pruned on the nodes we sync from
+type ArchiveNodeType struct {
+	Node       string `yaml:"node"`       //as node of the network's backend (daemon: --node; replay: a directory with recordings)
+	FromHeight int    `yaml:"fromHeight"` //first height the node has; 0: from genesis
+	ToHeight   int    `yaml:"toHeight"`   //last height the node has (e.g. of a halted chain's archive); 0: up to now
+}
+
+//an asset (coin) of a network together with the trade pairs to price it
+type AssetType struct {
+	Denom          string             `yaml:"denom"`      //display denom, used as currency in the csv
+	ChainDenom     string             `yaml:"chainDenom"` //on-chain (base) denom, e.g. uatom, ibc/27394FB0... or factory/osmo1.../token
+	Exponent       int                `yaml:"exponent"`
+	TradePairs4Tax TradePairs4TaxType `yaml:"tradePairs4Tax"`
+}
+
 //config from yaml file
 //note to unmarshall the data to the struct, the fields must be public(uppercase)
 type Cfg struct {
@@ -24,20 +39,33 @@ type Cfg struct {
 		Exponent       int                `yaml:"exponent"`
 		FeeDenom       string             `yaml:"feedenom"`
 		KeepConfigNode bool               `yaml:"keepConfigNode"`
-		Node           string             `yaml:"node"`
+		Backend        string             `yaml:"backend"`       //how to fetch txs: daemon (default, uses the daemon's cli), rpc (node's json-rpc), lcd (node's rest api) or replay (recorded txs)
+		Node           string             `yaml:"node"`          //rpc/lcd backend: node to use (daemon backend uses the daemon's config node)
+		Nodes          []string           `yaml:"nodes"`         //further nodes to fail over to during the sync (before the chain registry's)
+		ArchiveNodes   []ArchiveNodeType  `yaml:"archiveNodes"`  //nodes to backfill heights the sync nodes pruned before we fetched them
+		ReplayDir      string             `yaml:"replayDir"`     //replay backend: directory holding <name>_<addr>.json with recorded txs
+		QueryIncoming  bool               `yaml:"queryIncoming"` //also query txs signed by others in which we received coins (transfer.recipient)
+		FeeRowsAllTxs  bool               `yaml:"feeRowsAllTxs"` //also write fee-only rows for txs we signed without tax relevant messages (votes, sends, ibc transfers)
 		TradePairs4Tax TradePairs4TaxType `yaml:"tradePairs4Tax"`
+		Assets         []AssetType        `yaml:"assets"` //further tracked assets (e.g. rewards paid in other denoms) besides denom/feedenom
 		// TradePairs4Tax struct {
 		// 	EndPoint string   `yaml:"endpoint"`
 		// 	Pairs    []string `yaml:"pairs"`
 		// } `yaml:"tradePairs4Tax"`
 	} `yaml:"networks"`
 	Query struct {
-		PageLimit  int `yaml:"pageLimit"`
-		TxStepBack int `yaml:"txStepBack"`
-		Nretry     int `yaml:"nRetry"`
-		Tretry     int `yaml:"tRetry"`
+		PageLimit     int    `yaml:"pageLimit"`
+		TxStepBack    int    `yaml:"txStepBack"`
+		Nretry        int    `yaml:"nRetry"`
+		Tretry        int    `yaml:"tRetry"`
+		SyncMode      string `yaml:"syncMode"`      //count (default) or height
+		Workers       int    `yaml:"workers"`       //addresses (of all networks) synced concurrently; 0/1 (default): one after the other
+		NodeLimit     int    `yaml:"nodeLimit"`     //max concurrent queries to one node (over all workers); 0: 2
+		FailoverAfter int    `yaml:"failoverAfter"` //failed tries of a query before failing over to the next node; 0: 3
 	} `yaml:"query"`
 	TaxRelevantMessageTypes []string `yaml:"taxRelevantMessageTypes"`
+	FiatDecimals            int      `yaml:"fiatDecimals"`  //round the fiat values in the csv to this number of decimals; 0 (default): no rounding, amounts stay exact
+	FeeAllocation           string   `yaml:"feeAllocation"` //how the fee of a tx is split over its tax relevant messages: first (default), even or proportional (to the received amount)
 }
 
 type CfgAdr struct {
@@ -50,6 +78,13 @@ type CfgAdr struct {
 	} `yaml:"addresses"`
 }
 
+//one address of a network with its pubkey (optional), e.g. as imported from a daemon's keyring
+type AddrEntry struct {
+	ChainName string
+	Addr      string
+	PubKey    string
+}
+
 //allows to extract the Addr or Pubkeys as slice per chain
 func (cfgAdr *CfgAdr) GetFieldString(addrIdx int, field string) []string {
 	var data []string
@@ -71,3 +106,25 @@ func (cfg *Cfg) GetNetworksFieldString(field string) []string {
 	}
 	return data
 }
+
+//all tracked assets of a network: the network's own (denom, feedenom, exponent, tradePairs4Tax) first, then the extra assets
+func (cfg *Cfg) GetNetworkAssets(networkIdx int) []AssetType {
+	network := cfg.Networks[networkIdx]
+	assets := []AssetType{{
+		Denom:          network.Denom,
+		ChainDenom:     network.FeeDenom,
+		Exponent:       network.Exponent,
+		TradePairs4Tax: network.TradePairs4Tax,
+	}}
+	return append(assets, network.Assets...)
+}
+
+//the tracked asset of a network with the given on-chain denom
+func (cfg *Cfg) GetNetworkAsset(networkIdx int, chainDenom string) (AssetType, bool) {
+	for _, asset := range cfg.GetNetworkAssets(networkIdx) {
+		if asset.ChainDenom == chainDenom {
+			return asset, true
+		}
+	}
+	return AssetType{}, false
+}
@@ -2,6 +2,7 @@
 package exch
 
 import (
+	"alexp/stakingtax/pkg/coins"
 	"alexp/stakingtax/pkg/configData"
 	"alexp/stakingtax/pkg/taxcsv"
 	"alexp/stakingtax/pkg/utils"
@@ -14,43 +15,87 @@ import (
 	"time"
 )
 
-type funcEndPointHandler func(time.Time, string, string) (float64, bool)
+type funcEndPointHandler func(time.Time, string, string) (coins.Dec, bool)
 
 var endpointM = map[string]funcEndPointHandler{
 	"cbpro":   GetFiatBaseFactCBPro,
 	"binance": GetFiatBaseFactBinance,
 }
 
-func AddFiatBaseInfo2TaxCsvData(tradePairs4Tax *configData.TradePairs4TaxType, allNewTaxCsvRows []*taxcsv.TaxCsv, sLogSep string) {
-	var amountBase float64
+//Adds the fiat values to the rows; every row is priced with the trade pairs of its asset (received currency),
+//rows of assets not tracked (or without trade pairs) are kept unpriced (fiat values 0).
+//The fiat values are exact, fiatDecimals > 0 rounds them (the only place where we round).
+func AddFiatBaseInfo2TaxCsvData(assets []configData.AssetType, allNewTaxCsvRows []*taxcsv.TaxCsv, fiatDecimals int, sLogSep string) {
+	var amountBase coins.Dec
 	var tOk bool
-	var fact float64
+	var fact coins.Dec
+	var asset *configData.AssetType
+	reportedUnpriced := map[string]bool{}
 
 	for _, row := range allNewTaxCsvRows {
 
-		// get conversion fact (we can neglect tOk here, as it is handled internally)
-		amountBase, fact, tOk = GetFiatBaseAmountForDay(tradePairs4Tax, row.Timestamp, row.ReceivedAmount, sLogSep)
+		tOk = false
+		asset = findAsset(assets, row.ReceivedCurrency)
+		if asset != nil && len(asset.TradePairs4Tax.Pairs) > 0 {
+			// get conversion fact (we can neglect tOk here, as it is handled internally)
+			amountBase, fact, tOk = GetFiatBaseAmountForDay(&asset.TradePairs4Tax, row.Timestamp, row.ReceivedAmount, sLogSep)
+		} else if !reportedUnpriced[row.ReceivedCurrency] {
+			log.Println(sLogSep + "[I] no trade pairs for: " + row.ReceivedCurrency + " -> rows kept unpriced")
+			reportedUnpriced[row.ReceivedCurrency] = true
+		}
 
 		//if not ok we leave the value as initialized (0)
 		if tOk {
-			row.ReceivedFiatAmount = amountBase
+			row.ReceivedFiatAmount = roundFiat(amountBase, fiatDecimals)
+		}
 
-			//no need to query again, we know the factor:
-			row.FeeFiatAmount = row.FeeAmount * fact
+		if row.FeeAmount.IsZero() {
+			continue
+		}
+		if row.FeeCurrency == row.ReceivedCurrency {
+			if tOk {
+				//no need to query again, we know the factor:
+				row.FeeFiatAmount = roundFiat(row.FeeAmount.Mul(fact), fiatDecimals)
+			}
+		} else {
+			//fee in an other asset than the received one
+			asset = findAsset(assets, row.FeeCurrency)
+			if asset != nil && len(asset.TradePairs4Tax.Pairs) > 0 {
+				amountBase, _, tOk = GetFiatBaseAmountForDay(&asset.TradePairs4Tax, row.Timestamp, row.FeeAmount, sLogSep)
+				if tOk {
+					row.FeeFiatAmount = roundFiat(amountBase, fiatDecimals)
+				}
+			}
 		}
 
 	}
 
 }
 
+func roundFiat(amount coins.Dec, fiatDecimals int) coins.Dec {
+	if fiatDecimals > 0 {
+		return amount.Round(fiatDecimals)
+	}
+	return amount
+}
+
+//the asset with the given (display) denom, nil if not tracked
+func findAsset(assets []configData.AssetType, denom string) *configData.AssetType {
+	for i := range assets {
+		if assets[i].Denom == denom {
+			return &assets[i]
+		}
+	}
+	return nil
+}
+
 //Gets the close price in teax base for a given trading pair and day/time string in RFC3339 format "2006-01-02T15:04:05Z07:00", "2006-01-02T15:04:05Z"
 //via coinbase pro API.
 //The tradePairs are executed in the given sequence, the final unit is regarded as base unit. E.g. [FET-BTC BTC-EUR]
-func GetFiatBaseAmountForDay(tradePairs4Tax *configData.TradePairs4TaxType, sDate string, amount float64, sLogSep string) (float64, float64, bool) {
+func GetFiatBaseAmountForDay(tradePairs4Tax *configData.TradePairs4TaxType, sDate string, amount coins.Dec, sLogSep string) (coins.Dec, coins.Dec, bool) {
 	tOk := false
-	var baseAmount float64
-	baseAmount = 0.0
-	var fact, factOut float64
+	var baseAmount coins.Dec
+	var fact, factOut coins.Dec
 
 	//convert date
 	layout := "2006-01-02T15:04:05Z07:00"
@@ -59,13 +104,13 @@ func GetFiatBaseAmountForDay(tradePairs4Tax *configData.TradePairs4TaxType, sDat
 
 	//get api snippets for this endpoint (excluding the pair)
 
-	fact = 1.0
+	fact, _ = coins.NewDecFromString("1")
 	for _, pair := range tradePairs4Tax.Pairs {
 
 		//call the endpoint related function
 		factOut, tOk = endpointM[tradePairs4Tax.EndPoint](t, pair, sLogSep+"   ")
 
-		fact = fact * factOut //we have 0.0 returned in case retrieval failed (this was reported in the routine)
+		fact = fact.Mul(factOut) //we have 0.0 returned in case retrieval failed (this was reported in the routine)
 
 		//no need to continue if one conversion failed
 		if !tOk {
@@ -73,15 +118,15 @@ func GetFiatBaseAmountForDay(tradePairs4Tax *configData.TradePairs4TaxType, sDat
 		}
 	}
 
-	baseAmount = amount * fact //will be 0.0 if retrieval of any conversion fact failed
+	baseAmount = amount.Mul(fact) //will be 0.0 if retrieval of any conversion fact failed
 	return baseAmount, fact, tOk
 
 }
 
-func GetFiatBaseFactCBPro(t time.Time, pair string, sLogSep string) (float64, bool) {
+func GetFiatBaseFactCBPro(t time.Time, pair string, sLogSep string) (coins.Dec, bool) {
 	var err error
 	var url string
-	var factOut float64
+	var factOut coins.Dec
 	var tSucc bool
 	var closeTime0 float64
 	var tResClose0 time.Time
@@ -89,7 +134,7 @@ func GetFiatBaseFactCBPro(t time.Time, pair string, sLogSep string) (float64, bo
 	//https://go.dev/play/p/0MUY-yOYII how to unmarshal mixed json (with / without name: value)
 
 	//type CBProData [][6]interface{}
-	type CBProData [2][6]float64
+	type CBProData [2][6]json.Number //numbers kept as given, so the price is exact
 	/* https://docs.cloud.coinbase.com/exchange/reference/exchangerestapi_getproductcandles
 	   coinbase pro provides a vector of 6 float64 fields
 	       time bucket start time
@@ -135,7 +180,7 @@ func GetFiatBaseFactCBPro(t time.Time, pair string, sLogSep string) (float64, bo
 	utils.ErrDefaultFatal(err)
 
 	tSucc = true
-	factOut = 0.0
+	factOut = coins.Dec{}
 
 	//sanity check format of response
 	if len(cbProData) != 2 || len(cbProData[0]) != 6 {
@@ -144,7 +189,7 @@ func GetFiatBaseFactCBPro(t time.Time, pair string, sLogSep string) (float64, bo
 	}
 
 	//ass discussed above: [0] bucket's start time is the [1] buckets close time (which is what we are interested in)
-	closeTime0 = cbProData[0][0]
+	closeTime0, _ = cbProData[0][0].Float64()
 	tResClose0 = time.Unix(int64(math.Round(closeTime0)), 0)
 
 	//sanity check time diff or close time
@@ -157,17 +202,21 @@ func GetFiatBaseFactCBPro(t time.Time, pair string, sLogSep string) (float64, bo
 
 	if tSucc {
 		//as discussed above: the [1] buckets close value is what we are interested in
-		factOut = cbProData[1][3] //3 is now open price, close was 4
+		factOut, err = coins.NewDecFromString(cbProData[1][3].String()) //3 is now open price, close was 4
+		if err != nil {
+			log.Printf(sLogSep+"[WARN] Can not convert CB Pro open to decimal! Skipping Fiat value for this data point! Error was %v ."+utils.FatalDetails(), err)
+			tSucc = false
+		}
 	}
 
 	return factOut, tSucc
 
 }
 
-func GetFiatBaseFactBinance(t time.Time, pair string, sLogSep string) (float64, bool) {
+func GetFiatBaseFactBinance(t time.Time, pair string, sLogSep string) (coins.Dec, bool) {
 	var err error
 	var url string
-	var factOut float64
+	var factOut coins.Dec
 	var tSucc bool
 	var closeTime float64
 	var tResClose time.Time
@@ -215,7 +264,7 @@ func GetFiatBaseFactBinance(t time.Time, pair string, sLogSep string) (float64,
 	utils.ErrDefaultFatal(err)
 
 	tSucc = true
-	factOut = 0.0
+	factOut = coins.Dec{}
 
 	//sanity check format of response
 	if len(binanceData) != 1 || len(binanceData[0]) != 12 {
@@ -237,9 +286,9 @@ func GetFiatBaseFactBinance(t time.Time, pair string, sLogSep string) (float64,
 
 	if tSucc {
 		sClose := binanceData[0][1].(string) //close was [4]
-		factOut, err = strconv.ParseFloat(sClose, 64)
+		factOut, err = coins.NewDecFromString(sClose)
 		if err != nil {
-			log.Printf(sLogSep+"[WARN] Can not convert binance close to float! Skipping Fiat value for this data point! Error was %w ."+utils.FatalDetails(), err)
+			log.Printf(sLogSep+"[WARN] Can not convert binance close to decimal! Skipping Fiat value for this data point! Error was %w ."+utils.FatalDetails(), err)
 			tSucc = false
 		}
 
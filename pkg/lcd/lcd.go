@@ -0,0 +1,268 @@
+// lcd.go
+package lcd
+
+import (
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io/ioutil"
+	"net/http"
+	"net/url"
+	"regexp"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+)
+
+// minimal client for the cosmos LCD/REST (grpc-gateway) endpoints we need
+type Client struct {
+	Addr       string
+	HttpClient *http.Client
+
+	sdkMu      sync.Mutex
+	sdkVersion *sdkVersion //the node's, detected on the first txs query (the paging parameters depend on it)
+}
+
+type NodeInfoResp struct {
+	DefaultNodeInfo struct {
+		Network string `json:"network"`
+		Version string `json:"version"`
+	} `json:"default_node_info"`
+	ApplicationVersion struct {
+		CosmosSdkVersion string `json:"cosmos_sdk_version"`
+	} `json:"application_version"`
+}
+
+// major and minor of a cosmos sdk version like v0.47.5 or v0.45.16-ics-lsm
+type sdkVersion struct {
+	major int
+	minor int
+}
+
+var reSdkVersion = regexp.MustCompile(`^v?(\d+)\.(\d+)`)
+
+// a version we can not read (e.g. a fork's) is taken as the latest one
+var sdkVersionLatest = sdkVersion{major: 0, minor: 50}
+
+func parseSdkVersion(s string) sdkVersion {
+	match := reSdkVersion.FindStringSubmatch(s)
+	if match == nil {
+		return sdkVersionLatest
+	}
+	major, _ := strconv.Atoi(match[1])
+	minor, _ := strconv.Atoi(match[2])
+	return sdkVersion{major: major, minor: minor}
+}
+
+func (v sdkVersion) atLeast(major int, minor int) bool {
+	return v.major > major || (v.major == major && v.minor >= minor)
+}
+
+// /cosmos/tx/v1beta1/txs result; tx_responses are kept raw as they have the format of the daemon's 'query txs' output
+type TxsEventResp struct {
+	TxResponses json.RawMessage `json:"tx_responses"`
+	Pagination  struct {
+		Total string `json:"total"`
+	} `json:"pagination"`
+	Total string `json:"total"` //since sdk 0.47 the total is given here (pagination is deprecated)
+}
+
+// grpc-gateway error
+type errResp struct {
+	Code    int    `json:"code"`
+	Message string `json:"message"`
+}
+
+// grpc code of an unknown entity, e.g. an account that never received anything
+const grpcCodeNotFound = 5
+
+// a request answered with a status other than 200; Code and Message are set if the gateway gave a grpc error
+type StatusError struct {
+	Path       string
+	StatusCode int
+	Status     string
+	Code       int
+	Message    string
+}
+
+func (e *StatusError) Error() string {
+	if e.Message != "" {
+		return fmt.Sprintf("%s failed with statusCode: %d: %s (code %d)", e.Path, e.StatusCode, e.Message, e.Code)
+	}
+	return fmt.Sprintf("%s failed with statusCode: %d and status %s", e.Path, e.StatusCode, e.Status)
+}
+
+// did the node answer that the requested entity does not exist (http 404 or grpc NotFound)?
+func IsNotFound(err error) bool {
+	var statusErr *StatusError
+	if !errors.As(err, &statusErr) {
+		return false
+	}
+	return statusErr.StatusCode == http.StatusNotFound || statusErr.Code == grpcCodeNotFound
+}
+
+func NewClient(addr string, timeout time.Duration) *Client {
+	return &Client{
+		Addr:       strings.TrimSuffix(addr, "/"),
+		HttpClient: &http.Client{Timeout: timeout},
+	}
+}
+
+// GET addr/path?params and unmarshal the json into result
+func (c *Client) get(path string, params url.Values, result interface{}) error {
+	u := c.Addr + path
+	if len(params) > 0 {
+		u += "?" + params.Encode()
+	}
+
+	res, err := c.HttpClient.Get(u)
+	if err != nil {
+		return err
+	}
+	defer res.Body.Close()
+
+	body, err := ioutil.ReadAll(res.Body)
+	if err != nil {
+		return err
+	}
+
+	if res.StatusCode != 200 {
+		statusErr := &StatusError{Path: path, StatusCode: res.StatusCode, Status: res.Status}
+		errR := errResp{}
+		if json.Unmarshal(body, &errR) == nil && errR.Message != "" {
+			statusErr.Code, statusErr.Message = errR.Code, errR.Message
+		}
+		return statusErr
+	}
+
+	return json.Unmarshal(body, result)
+}
+
+func (c *Client) NodeInfo() (*NodeInfoResp, error) {
+	nodeInfoR := &NodeInfoResp{}
+	err := c.get("/cosmos/base/tendermint/v1beta1/node_info", nil, nodeInfoR)
+	if err != nil {
+		return nil, err
+	}
+	return nodeInfoR, nil
+}
+
+// the node's sdk version; asked once, again after a failure
+func (c *Client) sdk() (sdkVersion, error) {
+	c.sdkMu.Lock()
+	defer c.sdkMu.Unlock()
+
+	if c.sdkVersion == nil {
+		nodeInfoR, err := c.NodeInfo()
+		if err != nil {
+			return sdkVersion{}, err
+		}
+		version := parseSdkVersion(nodeInfoR.ApplicationVersion.CosmosSdkVersion)
+		c.sdkVersion = &version
+	}
+	return *c.sdkVersion, nil
+}
+
+// events are conditions like message.sender='addr' (all must hold); page starts at 1, txs are returned in ascending order.
+// The parameters depend on the node's sdk version: events & pagination (<0.47), events & page & limit (0.47),
+// query & page & limit (0.50)
+func (c *Client) TxsEvent(events []string, page int, limit int) (*TxsEventResp, error) {
+	version, err := c.sdk()
+	if err != nil {
+		return nil, err
+	}
+
+	params := url.Values{}
+	if version.atLeast(0, 50) {
+		params.Set("query", strings.Join(events, " AND "))
+	} else {
+		for _, event := range events {
+			params.Add("events", event)
+		}
+	}
+	if version.atLeast(0, 47) {
+		params.Set("page", strconv.Itoa(page))
+		params.Set("limit", strconv.Itoa(limit))
+	} else {
+		params.Set("pagination.offset", strconv.Itoa((page-1)*limit))
+		params.Set("pagination.limit", strconv.Itoa(limit))
+		params.Set("pagination.count_total", "true")
+	}
+	params.Set("order_by", "ORDER_BY_ASC")
+
+	txsEventR := &TxsEventResp{}
+	err = c.get("/cosmos/tx/v1beta1/txs", params, txsEventR)
+	if err != nil {
+		return nil, err
+	}
+
+	if txsEventR.Total == "" {
+		txsEventR.Total = txsEventR.Pagination.Total
+	}
+	return txsEventR, nil
+}
+
+var reLowestHeight = regexp.MustCompile(`lowest height is (\d+)`)
+
+// earliest block height the node still has; the rest api has no direct way to ask for it, but a pruned
+// node reports it when asked for block 1
+func (c *Client) EarliestHeight() (int, error) {
+	var blockR json.RawMessage
+	err := c.get("/cosmos/base/tendermint/v1beta1/blocks/1", nil, &blockR)
+	if err == nil {
+		return 1, nil
+	}
+
+	match := reLowestHeight.FindStringSubmatch(err.Error())
+	if match == nil {
+		return 0, err
+	}
+	return strconv.Atoi(match[1])
+}
+
+// the account as json (type dependent: BaseAccount, vesting accounts, ...), in the format of the daemon's 'query account'
+func (c *Client) Account(addr string) (json.RawMessage, error) {
+	accountR := struct {
+		Account json.RawMessage `json:"account"`
+	}{}
+	err := c.get("/cosmos/auth/v1beta1/accounts/"+url.PathEscape(addr), nil, &accountR)
+	if err != nil {
+		return nil, err
+	}
+	return accountR.Account, nil
+}
+
+// height and time of the node's latest block; sdk 0.47+ gives the header in sdk_block, the block is kept for older versions
+func (c *Client) LatestBlock() (string, string, error) {
+	type header struct {
+		Header struct {
+			Height string `json:"height"`
+			Time   string `json:"time"`
+		} `json:"header"`
+	}
+	blockR := struct {
+		Block    header `json:"block"`
+		SdkBlock header `json:"sdk_block"`
+	}{}
+	err := c.get("/cosmos/base/tendermint/v1beta1/blocks/latest", nil, &blockR)
+	if err != nil {
+		return "", "", err
+	}
+	if blockR.SdkBlock.Header.Height != "" {
+		return blockR.SdkBlock.Header.Height, blockR.SdkBlock.Header.Time, nil
+	}
+	return blockR.Block.Header.Height, blockR.Block.Header.Time, nil
+}
+
+// is the node still catching up?
+func (c *Client) Syncing() (bool, error) {
+	syncingR := struct {
+		Syncing bool `json:"syncing"`
+	}{}
+	err := c.get("/cosmos/base/tendermint/v1beta1/syncing", nil, &syncingR)
+	if err != nil {
+		return false, err
+	}
+	return syncingR.Syncing, nil
+}
@@ -0,0 +1,143 @@
+package lcd
+
+import (
+	"fmt"
+	"net/http"
+	"net/http/httptest"
+	"net/url"
+	"testing"
+	"time"
+)
+
+const testEvent = "message.sender='cosmos1ycv7ag92g3v4gmd7fsf9jjsz527qwpr3cd8pqn'"
+const testEvent2 = "tx.height>=100"
+
+// stand-in node of the given sdk version answering /node_info and /txs; the txs queries' parameters are recorded
+func newTestNode(t *testing.T, sdkVersion string, nodeInfoCalls *int, txsParams *[]url.Values) *httptest.Server {
+	return httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		switch r.URL.Path {
+		case "/cosmos/base/tendermint/v1beta1/node_info":
+			*nodeInfoCalls++
+			fmt.Fprintf(w, `{"default_node_info":{"network":"cosmoshub-4","version":"0.37.2"},
+				"application_version":{"name":"gaia","version":"v15.0.0","cosmos_sdk_version":"%s"}}`, sdkVersion)
+		case "/cosmos/tx/v1beta1/txs":
+			*txsParams = append(*txsParams, r.URL.Query())
+			fmt.Fprint(w, `{"txs":[],"tx_responses":[{"height":"100","txhash":"AB12"}],"pagination":{"next_key":null,"total":"31"},"total":"31"}`)
+		default:
+			t.Errorf("unexpected request %s", r.URL.Path)
+			http.NotFound(w, r)
+		}
+	}))
+}
+
+func TestTxsEvent(t *testing.T) {
+	tests := []struct {
+		sdkVersion string
+		want       map[string][]string //parameters sent, besides order_by
+	}{
+		{"v0.45.16-ics-lsm", map[string][]string{
+			"events":                 {testEvent, testEvent2},
+			"pagination.offset":      {"30"},
+			"pagination.limit":       {"30"},
+			"pagination.count_total": {"true"},
+		}},
+		{"v0.47.5", map[string][]string{
+			"events": {testEvent, testEvent2},
+			"page":   {"2"},
+			"limit":  {"30"},
+		}},
+		{"v0.50.3", map[string][]string{
+			"query": {testEvent + " AND " + testEvent2},
+			"page":  {"2"},
+			"limit": {"30"},
+		}},
+		//unreadable: the latest version's parameters
+		{"", map[string][]string{
+			"query": {testEvent + " AND " + testEvent2},
+			"page":  {"2"},
+			"limit": {"30"},
+		}},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.sdkVersion, func(t *testing.T) {
+			var nodeInfoCalls int
+			var txsParams []url.Values
+			node := newTestNode(t, tt.sdkVersion, &nodeInfoCalls, &txsParams)
+			defer node.Close()
+			client := NewClient(node.URL+"/", 5*time.Second)
+
+			for i := 0; i < 2; i++ {
+				txsEventR, err := client.TxsEvent([]string{testEvent, testEvent2}, 2, 30)
+				if err != nil {
+					t.Fatal(err)
+				}
+				if txsEventR.Total != "31" || len(txsEventR.TxResponses) == 0 {
+					t.Errorf("total %s, tx_responses %s", txsEventR.Total, txsEventR.TxResponses)
+				}
+			}
+			if nodeInfoCalls != 1 {
+				t.Errorf("sdk version asked %d times, want once", nodeInfoCalls)
+			}
+
+			params := txsParams[0]
+			if params.Get("order_by") != "ORDER_BY_ASC" {
+				t.Errorf("order_by = %s", params.Get("order_by"))
+			}
+			params.Del("order_by")
+			if len(params) != len(tt.want) {
+				t.Errorf("parameters %v, want %v", params, tt.want)
+			}
+			for key, want := range tt.want {
+				if fmt.Sprint(params[key]) != fmt.Sprint(want) {
+					t.Errorf("%s = %v, want %v", key, params[key], want)
+				}
+			}
+		})
+	}
+}
+
+// sdk 0.45 gives the total in the pagination only
+func TestTxsEventPaginationTotal(t *testing.T) {
+	node := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		switch r.URL.Path {
+		case "/cosmos/base/tendermint/v1beta1/node_info":
+			fmt.Fprint(w, `{"application_version":{"cosmos_sdk_version":"v0.45.1"}}`)
+		default:
+			fmt.Fprint(w, `{"tx_responses":[],"pagination":{"total":"7"}}`)
+		}
+	}))
+	defer node.Close()
+
+	txsEventR, err := NewClient(node.URL, 5*time.Second).TxsEvent([]string{testEvent}, 1, 30)
+	if err != nil || txsEventR.Total != "7" {
+		t.Errorf("TxsEvent() = %v, %v; want a total of 7", txsEventR, err)
+	}
+}
+
+// the sdk version is asked again after a failure
+func TestTxsEventNodeInfoFails(t *testing.T) {
+	var nFailing = 1
+	node := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		switch r.URL.Path {
+		case "/cosmos/base/tendermint/v1beta1/node_info":
+			if nFailing > 0 {
+				nFailing--
+				w.WriteHeader(http.StatusServiceUnavailable)
+				return
+			}
+			fmt.Fprint(w, `{"application_version":{"cosmos_sdk_version":"v0.47.5"}}`)
+		default:
+			fmt.Fprint(w, `{"tx_responses":[],"total":"0"}`)
+		}
+	}))
+	defer node.Close()
+	client := NewClient(node.URL, 5*time.Second)
+
+	if _, err := client.TxsEvent([]string{testEvent}, 1, 30); err == nil {
+		t.Error("want the node_info error")
+	}
+	if _, err := client.TxsEvent([]string{testEvent}, 1, 30); err != nil {
+		t.Errorf("TxsEvent() after the node recovered: %v", err)
+	}
+}
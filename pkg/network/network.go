@@ -2,20 +2,36 @@
 package network
 
 import (
+	"bytes"
 	"context"
+	"encoding/base64"
 	"encoding/json"
 	"fmt"
 	"log"
 	"net/http"
+	"net/url"
 	"os/exec"
+	"strconv"
+	"strings"
 	"time"
 
 	"golang.org/x/exp/slices"
 
+	"alexp/stakingtax/pkg/address"
 	"alexp/stakingtax/pkg/configData"
+	"alexp/stakingtax/pkg/lcd"
+	"alexp/stakingtax/pkg/rpc"
 	"alexp/stakingtax/pkg/utils"
 )
 
+// backends to fetch txs, as given by backend in config.yaml
+const (
+	BackendDaemon = "daemon"
+	BackendRpc    = "rpc"
+	BackendLcd    = "lcd"
+	BackendReplay = "replay"
+)
+
 type ChainInfoSub struct {
 	RecommendedVersion string   `json:"recommended_version"`
 	CompatibleVersions []string `json:"compatible_versions"`
@@ -23,10 +39,12 @@ type ChainInfoSub struct {
 
 // chainInfo subpart of the json
 type ChainInfo struct {
-	ChainName  string `json:"chain_name"`
-	ChainId    string `json:"chain_id"`
-	DaemonName string `json:"daemon_name"`
-	Codebase   struct {
+	ChainName    string `json:"chain_name"`
+	ChainId      string `json:"chain_id"`
+	DaemonName   string `json:"daemon_name"`
+	Bech32Prefix string `json:"bech32_prefix"`
+	Slip44       int    `json:"slip44"` //coin type of the key derivation path, chains sharing it share the addresses' bytes
+	Codebase     struct {
 		RecommendedVersion string         `json:"recommended_version"`
 		CompatibleVersions []string       `json:"compatible_versions"`
 		Versions           []ChainInfoSub `json:"versions"` //since 2023 there is also versions and not only codebase; however still use codebase (versions seem only having extra entries during upgrade)
@@ -35,27 +53,64 @@ type ChainInfo struct {
 		Rpc []struct {
 			Address string `json:"address"`
 		} `json:"rpc"`
+		Rest []struct {
+			Address string `json:"address"`
+		} `json:"rest"`
 	} `json:"apis"`
-	TProcess bool `json:"ourExtraParameter"`
+	TProcess  bool        `json:"ourExtraParameter"`
+	Backend   string      `json:"-"` //our extra parameters: backend used for this network
+	RpcClient *rpc.Client `json:"-"` //rpc backend: client for the responsive node
+	LcdClient *lcd.Client `json:"-"` //lcd backend: client for the responsive node
+	ReplayDir string      `json:"-"` //replay backend: directory holding the recorded txs
+	NodePool  []string    `json:"-"` //nodes to fail over to during the sync: the responsive node first ("" for the daemon's config node), then the nodes of config.yaml and the chain registry
 }
 
-// checks network configurations and possibly updates the config
-func CheckNetworks(cfg *configData.Cfg) []ChainInfo {
+// checks network configurations and possibly updates the config; nodes are chosen to cover the addresses' last synced height
+func CheckNetworks(cfg *configData.Cfg, cfgAdr *configData.CfgAdr) []ChainInfo {
 
 	var chainInfos []ChainInfo
 	var chainName string
+	var lastHeight int
 
 	log.Println("Checking networks ===============================================================================")
 
 	for i, chainDetails := range cfg.Networks {
 		chainName = chainDetails.Name
 		log.Println("Checking: " + chainName + " --------------------------------------------------------")
+
+		if chainDetails.Backend == BackendReplay {
+			//recorded txs from disk: nothing to check, no need for the chain registry
+			log.Println("[OK] replaying recorded txs from: " + chainDetails.ReplayDir)
+			chainInfos = append(chainInfos, ChainInfo{ChainName: chainName, TProcess: true, Backend: BackendReplay, ReplayDir: chainDetails.ReplayDir})
+			continue
+		}
+
 		//fetch chain_info from git hub
 		chainInfos = append(chainInfos, fetchChainInfo(cfg, chainName))
 
-		ensureValidDaemonVersion(chainInfos[i])
-		ensureCorrectConfigChainId(chainInfos[i])
-		ensureCorrectConfigNode(&chainInfos[i], chainDetails.KeepConfigNode)
+		chainInfos[i].Backend = chainDetails.Backend
+		if chainInfos[i].Backend == "" {
+			chainInfos[i].Backend = BackendDaemon
+		}
+
+		//txs after this height are still to be fetched: prefer nodes not pruned above it
+		lastHeight = lastSyncedHeight(cfgAdr, chainName)
+
+		switch chainInfos[i].Backend {
+		case BackendDaemon:
+			ensureValidDaemonVersion(chainInfos[i])
+			ensureCorrectConfigChainId(chainInfos[i])
+			ensureCorrectConfigNode(&chainInfos[i], chainDetails.KeepConfigNode, lastHeight)
+		case BackendRpc, BackendLcd:
+			//no daemon needed: we talk to the node's json-rpc or rest api directly
+			ensureResponsiveApiNode(&chainInfos[i], chainDetails.Node, chainDetails.KeepConfigNode, lastHeight)
+		default:
+			log.Fatal("Unknown backend: " + chainInfos[i].Backend + " for network: " + chainName + ". " + utils.FatalDetails())
+		}
+
+		if chainInfos[i].TProcess {
+			chainInfos[i].initNodePool(chainDetails.Nodes)
+		}
 	}
 	log.Println("[OK] checking networks ==========================================================================")
 	log.Println("")
@@ -63,6 +118,159 @@ func CheckNetworks(cfg *configData.Cfg) []ChainInfo {
 	return chainInfos
 } // CheckNetworks
 
+// checks the addresses' prefix against the chain registry's bech32_prefix (the checksum was checked when reading addr.yaml)
+func CheckAddresses(cfgAdr *configData.CfgAdr, chainInfos []ChainInfo) {
+	var tFailed bool
+
+	log.Println("Checking addresses")
+	for _, network := range cfgAdr.Addresses {
+		idx := slices.IndexFunc(chainInfos, func(chainI ChainInfo) bool { return chainI.ChainName == network.ChainName })
+		if idx == -1 || chainInfos[idx].Bech32Prefix == "" {
+			continue //not in config (skipped later on) or no registry info (replay)
+		}
+
+		for _, addrEntry := range network.AddrList {
+			prefix, err := address.Prefix(addrEntry.Addr)
+			utils.ErrDefaultFatal(err) //already checked in config.GetAddrFromFile
+			if prefix != chainInfos[idx].Bech32Prefix {
+				log.Println("    [WARN] " + addrEntry.Addr + " is no " + network.ChainName + " address (its prefix should be " + chainInfos[idx].Bech32Prefix + ")")
+				tFailed = true
+			}
+		}
+	}
+
+	if tFailed {
+		log.Fatal("Addresses in addr.yaml with a prefix not matching their network. " + utils.FatalDetails())
+	}
+	log.Println("    [OK] addresses match their networks")
+}
+
+// addr.yaml entries of the address for the given networks: the address' bytes re-encoded with each network's prefix.
+// Only networks with the same coin type (slip44) as the address' network (the one with its prefix) share the key,
+// the others are reported and skipped.
+func DeriveAddrEntries(cfg *configData.Cfg, addr string, chainNames []string) string {
+	var chainInfos []ChainInfo
+	var srcChainI *ChainInfo
+	var sb strings.Builder
+
+	prefix, addrBytes, err := address.Decode(addr)
+	utils.ErrDefaultFatal(err) //on err log.Fatal with details
+
+	log.Println("Deriving addresses of " + addr + " ================================================================")
+	for _, chainName := range chainNames {
+		chainInfos = append(chainInfos, fetchChainInfo(cfg, chainName))
+	}
+	for i := range chainInfos {
+		if chainInfos[i].Bech32Prefix == prefix {
+			srcChainI = &chainInfos[i]
+			break
+		}
+	}
+	if srcChainI == nil {
+		log.Fatal("None of the networks has the prefix " + prefix + " of " + addr + ", add its network to the list. " + utils.FatalDetails())
+	}
+
+	sb.WriteString("addresses:\n")
+	for _, chainI := range chainInfos {
+		if chainI.Slip44 != srcChainI.Slip44 {
+			log.Printf("    [I] skipping %v: coin type %v differs from %v's %v -> other key, other address\n", chainI.ChainName, chainI.Slip44, srcChainI.ChainName, srcChainI.Slip44)
+			continue
+		}
+		chainAddr, err := address.Encode(chainI.Bech32Prefix, addrBytes)
+		utils.ErrDefaultFatal(err) //on err log.Fatal with details
+
+		log.Println("    [OK] " + chainI.ChainName + ": " + chainAddr)
+		sb.WriteString("  - chainName: " + chainI.ChainName + "\n    addrList:\n      - addr: " + chainAddr + "\n\n")
+	}
+
+	return sb.String()
+} //DeriveAddrEntries
+
+// json of '<daemon> keys list --output json'; pubkey is a json string ({"@type":...,"key":...}) in newer sdk versions,
+// a bech32 encoded (amino) pubkey in old ones
+type keyringKey struct {
+	Name    string `json:"name"`
+	Type    string `json:"type"`
+	Address string `json:"address"`
+	PubKey  string `json:"pubkey"`
+}
+
+// amino prefix of a secp256k1 pubkey in bech32 pubkeys like cosmospub1addwnpepq...
+var aminoSecp256k1Prefix = []byte{0xeb, 0x5a, 0xe9, 0x87, 0x21}
+
+// the addresses (and pubkeys) in the local keyring of each network's daemon. Only 'keys list' is run, which gives
+// public data only; keyringBackend (os, file, test, ...) is passed on if given, otherwise the daemon's default is used.
+func KeyringAddrEntries(cfg *configData.Cfg, keyringBackend string) []configData.AddrEntry {
+	var entries []configData.AddrEntry
+	var keys []keyringKey
+
+	log.Println("Importing addresses from the keyrings =========================================================")
+	for _, network := range cfg.Networks {
+		if network.Backend == BackendReplay {
+			log.Println("[I] skipping " + network.Name + ": replay backend, no daemon")
+			continue
+		}
+		chainI := fetchChainInfo(cfg, network.Name)
+		log.Println("Keyring of: " + chainI.DaemonName + " (" + network.Name + ")")
+
+		args := []string{"keys", "list", "--output", "json"}
+		if keyringBackend != "" {
+			args = append(args, "--keyring-backend", keyringBackend)
+		}
+		cmd := exec.Command(chainI.DaemonName, args...)
+		cmd.Stdin = nil //no passphrase prompt: a keyring asking for one (file backend) fails instead of blocking
+		out, err := cmd.Output()
+		if err != nil {
+			log.Println("    [W] " + chainI.DaemonName + " keys list failed: " + err.Error() + " -> skipping " + network.Name)
+			continue
+		}
+
+		keys = nil
+		err = json.Unmarshal(out, &keys)
+		if err != nil {
+			log.Println("    [W] unexpected output of " + chainI.DaemonName + " keys list: " + err.Error() + " -> skipping " + network.Name)
+			continue
+		}
+
+		for _, key := range keys {
+			prefix, err := address.Prefix(key.Address)
+			if err != nil || prefix != chainI.Bech32Prefix {
+				log.Println("    [W] skipping key " + key.Name + ": " + key.Address + " is no " + network.Name + " address")
+				continue
+			}
+			pubKey := keyringPubKey(key.PubKey)
+			if pubKey == "" {
+				log.Println("    [I] key " + key.Name + " (" + key.Type + "): no single pubkey, it will be discovered on chain")
+			}
+			log.Println("    [OK] " + key.Name + ": " + key.Address)
+			entries = append(entries, configData.AddrEntry{ChainName: network.Name, Addr: key.Address, PubKey: pubKey})
+		}
+	}
+	log.Println("[OK] importing addresses from the keyrings ====================================================")
+
+	return entries
+} //KeyringAddrEntries
+
+// base64 pubkey from the keyring's pubkey field; "" for multisig keys or unknown formats
+func keyringPubKey(sPubKey string) string {
+	pubKey := struct {
+		Key string `json:"key"`
+	}{}
+
+	if strings.HasPrefix(sPubKey, "{") {
+		if json.Unmarshal([]byte(sPubKey), &pubKey) != nil {
+			return ""
+		}
+		return pubKey.Key
+	}
+
+	_, pkBytes, err := address.Decode(sPubKey)
+	if err != nil || len(pkBytes) != len(aminoSecp256k1Prefix)+33 || !bytes.HasPrefix(pkBytes, aminoSecp256k1Prefix) {
+		return ""
+	}
+	return base64.StdEncoding.EncodeToString(pkBytes[len(aminoSecp256k1Prefix):])
+}
+
 // fetches chain_info.json from github chain-registry
 func fetchChainInfo(cfg *configData.Cfg, chainName string) ChainInfo {
 
@@ -191,23 +399,92 @@ func CheckNode(daemonName string, currAddr string, tcheckAddChannel bool) string
 	}
 } //checkNode
 
-func EnsurePortInAddress(currAddr string) string {
+// helper function: checks status of a given node via its json-rpc - is it responsive and serving the expected chain?
+func CheckNodeRpc(chainId string, currAddr string, tcheckAddChannel bool) string {
+
 	finalAddr := currAddr
-	//check if there is a :channel present, if not use default :443 (assumes a 3 digit channel)
-	//fmt.Println(currAddr[len(currAddr)-4 : len(currAddr)-3])
-	if currAddr[len(currAddr)-4:len(currAddr)-3] != ":" {
-		//check for trailng / which is invalid
-		//log.Print(currAddr[len(currAddr)-1:])
-		if currAddr[len(currAddr)-1:] == "/" {
-			finalAddr = currAddr[0 : len(currAddr)-1]
-		}
-		finalAddr += ":443"
+	if tcheckAddChannel {
+		finalAddr = EnsurePortInAddress(currAddr)
+	}
+
+	status, err := rpc.NewClient(finalAddr, 15*time.Second).Status()
+	if err != nil {
+		return ""
+	}
+	if status.NodeInfo.Network != chainId {
+		log.Println("	[W] node " + finalAddr + " serves chain-id " + status.NodeInfo.Network + " instead of " + chainId)
+		return ""
+	}
+	return finalAddr
+} //CheckNodeRpc
+
+// helper function: checks a given node via its rest api (lcd) - is it responsive and serving the expected chain?
+func CheckNodeLcd(chainId string, currAddr string, tcheckAddChannel bool) string {
+
+	finalAddr := currAddr
+	if tcheckAddChannel {
+		finalAddr = EnsurePortInAddress(currAddr)
+	}
+
+	nodeInfo, err := lcd.NewClient(finalAddr, 15*time.Second).NodeInfo()
+	if err != nil {
+		return ""
+	}
+	if nodeInfo.DefaultNodeInfo.Network != chainId {
+		log.Println("	[W] node " + finalAddr + " serves chain-id " + nodeInfo.DefaultNodeInfo.Network + " instead of " + chainId)
+		return ""
 	}
 	return finalAddr
+} //CheckNodeLcd
+
+// checks a node with the method of the network's backend; returns the address used or "" if not responsive
+func (chainI *ChainInfo) CheckNodeForBackend(currAddr string, tcheckAddChannel bool) string {
+	switch chainI.Backend {
+	case BackendRpc:
+		return CheckNodeRpc(chainI.ChainId, currAddr, tcheckAddChannel)
+	case BackendLcd:
+		return CheckNodeLcd(chainI.ChainId, currAddr, tcheckAddChannel)
+	default:
+		return CheckNode(chainI.DaemonName, currAddr, tcheckAddChannel)
+	}
+}
+
+// the chain registry's node list matching the network's backend (rest for lcd, rpc otherwise)
+func (chainI *ChainInfo) RegistryNodes() []string {
+	var nodes []string
+	if chainI.Backend == BackendLcd {
+		for _, v := range chainI.Apis.Rest {
+			nodes = append(nodes, v.Address)
+		}
+	} else {
+		for _, v := range chainI.Apis.Rpc {
+			nodes = append(nodes, v.Address)
+		}
+	}
+	return nodes
 }
 
-// ensures the node config to be correct (responsive node)
-func ensureCorrectConfigNode(chainI *ChainInfo, keepConfigNode bool) {
+// adds the default port :443 if the address has none (most chain registry nodes are given without); a trailing / is dropped
+func EnsurePortInAddress(currAddr string) string {
+	finalAddr := strings.TrimSuffix(currAddr, "/")
+
+	u, err := url.Parse(finalAddr)
+	if err != nil || u.Host == "" {
+		//no scheme, like host or host:26657
+		u, err = url.Parse("//" + finalAddr)
+		if err != nil || u.Host == "" {
+			return finalAddr
+		}
+	}
+	if u.Port() != "" {
+		return finalAddr
+	}
+	return strings.Replace(finalAddr, u.Host, u.Host+":443", 1)
+}
+
+// ensures the node config to be correct (responsive node, preferably synced, indexing txs and covering our last synced height)
+func ensureCorrectConfigNode(chainI *ChainInfo, keepConfigNode bool, lastHeight int) {
+	var configProbe *NodeProbe
 	log.Println("Checking to have a responsive node")
 
 	out, err := exec.Command(chainI.DaemonName, "config", "node").CombinedOutput()
@@ -217,10 +494,18 @@ func ensureCorrectConfigNode(chainI *ChainInfo, keepConfigNode bool) {
 
 	if nodeCurr != "" {
 		log.Println("	Checking responsiveness of your node in config: " + nodeCurr)
-		addrUsed := CheckNode(chainI.DaemonName, nodeCurr, false) //false: do not check channel, use it as it is
-		if addrUsed != "" {
-			log.Println("	[OK] -> node responded")
+		probe := chainI.ProbeNode(nodeCurr, false) //false: do not check channel, use it as it is
+		log.Println("	" + probe.String())
+		if probe.Covers(lastHeight) {
+			log.Println("	[OK] -> node responded and covers our last synced height " + strconv.Itoa(lastHeight))
 			return
+		} else if probe.Responsive() {
+			if keepConfigNode {
+				log.Println("	[W] -> node responded but is " + probe.Shortcoming(lastHeight) + "; keepConfigNode in config.yaml=true -> using it anyway")
+				return
+			}
+			log.Println("	-> node responded but is " + probe.Shortcoming(lastHeight) + "; keepConfigNode in config.yaml=false -> searching a better one")
+			configProbe = &probe
 		} else {
 			if keepConfigNode {
 				chainI.TProcess = false //mark as not to be processed
@@ -233,24 +518,18 @@ func ensureCorrectConfigNode(chainI *ChainInfo, keepConfigNode bool) {
 		}
 	}
 
-	//here we are left with the task to find a responsive node from the chain registry list
-	tFound := false
-	var addrUsed string
-	for _, v := range chainI.Apis.Rpc {
-		addrUsed = CheckNode(chainI.DaemonName, v.Address, true) //true: check channel
-		if addrUsed != "" {
-			log.Println("	[OK] -> " + addrUsed + " responded, adding it to config")
-			tFound = true
-			break
-		}
-	}
-
-	if tFound {
-		chainI.TProcess = true //reactivate as we found a responsive node
-	} else {
+	//here we are left with the task to find a node from the chain registry list, the config node is kept if none is better
+	addrUsed := chainI.selectNode(chainI.rankNodes(chainI.RegistryNodes()), lastHeight, configProbe)
+	if addrUsed == "" {
 		log.Println("	No responsive node found, giving up.")
 		return
 	}
+	chainI.TProcess = true //reactivate as we found a responsive node
+	if addrUsed == nodeCurr {
+		log.Println("	[OK] -> keeping your node in config")
+		return
+	}
+	log.Println("	[OK] -> using " + addrUsed + ", adding it to config")
 
 	//--- try to update config
 	_, err = exec.Command(chainI.DaemonName, "config", "node", addrUsed).CombinedOutput()
@@ -267,6 +546,83 @@ func ensureCorrectConfigNode(chainI *ChainInfo, keepConfigNode bool) {
 	}
 } //ensureCorrectConfigNode
 
+// ensures to have a responsive node for the rpc/lcd backend: the node given in config.yaml or one from the chain registry,
+// preferably synced, indexing txs and covering our last synced height
+func ensureResponsiveApiNode(chainI *ChainInfo, nodeCfg string, keepConfigNode bool, lastHeight int) {
+	var cfgProbe *NodeProbe
+	log.Println("Checking to have a responsive " + chainI.Backend + " node")
+
+	addrUsed := ""
+	if nodeCfg != "" {
+		log.Println("	Checking responsiveness of your node in config.yaml: " + nodeCfg)
+		probe := chainI.ProbeNode(nodeCfg, false) //false: do not check channel, use it as it is
+		log.Println("	" + probe.String())
+		if probe.Covers(lastHeight) {
+			log.Println("	[OK] -> node responded and covers our last synced height " + strconv.Itoa(lastHeight))
+			addrUsed = probe.Node
+		} else if probe.Responsive() && keepConfigNode {
+			log.Println("	[W] -> node responded but is " + probe.Shortcoming(lastHeight) + "; keepConfigNode in config.yaml=true -> using it anyway")
+			addrUsed = probe.Node
+		} else if probe.Responsive() {
+			log.Println("	-> node responded but is " + probe.Shortcoming(lastHeight) + "; keepConfigNode in config.yaml=false -> searching a better one")
+			cfgProbe = &probe
+		} else if keepConfigNode {
+			chainI.TProcess = false //mark as not to be processed
+			log.Println("	-> node did not respond, but keepConfigNode in config.yaml=true -> excluding this network from further processing in this run")
+			return
+		} else {
+			log.Println("	-> node did not respond, keepConfigNode in config.yaml=false -> searching a responsive one")
+		}
+	}
+
+	//search a node from the chain registry list, the config.yaml node is kept if none is better
+	if addrUsed == "" {
+		addrUsed = chainI.selectNode(chainI.rankNodes(chainI.RegistryNodes()), lastHeight, cfgProbe)
+		if addrUsed != "" {
+			log.Println("	[OK] -> using " + addrUsed + " in this run")
+		}
+	}
+
+	if addrUsed == "" {
+		chainI.TProcess = false
+		log.Println("	No responsive node found, giving up.")
+		return
+	}
+
+	if chainI.Backend == BackendLcd {
+		chainI.LcdClient = lcd.NewClient(addrUsed, 60*time.Second)
+	} else {
+		chainI.RpcClient = rpc.NewClient(addrUsed, 60*time.Second)
+	}
+} //ensureResponsiveApiNode
+
+// ranks the nodes to fail over to: the responsive node found in the check, the further nodes given in config.yaml
+// (as given), then the chain registry's (with port, best scored by the last -queryRpcNodes survey first). They are probed
+// when failing over: ones not usable or not covering the heights still to be fetched are skipped.
+func (chainI *ChainInfo) initNodePool(cfgNodes []string) {
+	var pool []string
+
+	switch chainI.Backend {
+	case BackendRpc:
+		pool = append(pool, chainI.RpcClient.Addr)
+	case BackendLcd:
+		pool = append(pool, chainI.LcdClient.Addr)
+	default:
+		pool = append(pool, "") //the daemon's config node
+	}
+	pool = append(pool, cfgNodes...)
+	for _, node := range chainI.rankNodes(chainI.RegistryNodes()) {
+		pool = append(pool, EnsurePortInAddress(node))
+	}
+
+	for _, node := range pool {
+		if !slices.Contains(chainI.NodePool, node) {
+			chainI.NodePool = append(chainI.NodePool, node)
+		}
+	}
+	log.Println("	[I] " + strconv.Itoa(len(chainI.NodePool)-1) + " further nodes to fail over to")
+}
+
 //This is similar to the standard Index function for slices, but applied
 //to our slice holding the address in a substruct Address from json unmarshalling
 //func indexAddressField(chainI ChainInfo, addr string) int {
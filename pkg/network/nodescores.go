@@ -0,0 +1,224 @@
+// nodescores.go
+package network
+
+import (
+	"encoding/csv"
+	"encoding/json"
+	"log"
+	"math"
+	"os"
+	"path/filepath"
+	"sort"
+	"strconv"
+	"strings"
+	"time"
+
+	"alexp/stakingtax/pkg/utils"
+)
+
+// cache of the last node survey (-queryRpcNodes), in the working dir next to the csv files
+const NodeScoresFile = "nodeScores.json"
+
+// survey results older than this are not used to rank nodes anymore
+const maxNodeScoresAge = 30 * 24 * time.Hour
+
+// tx count of one address: the one we have (count file) and the one the node reports; NodeCount is -1 if the query failed
+type AddrTxCount struct {
+	Addr      string `json:"addr"`
+	OurCount  int    `json:"our_count"`
+	NodeCount int    `json:"node_count"`
+	Error     string `json:"error,omitempty"`
+}
+
+// survey result of one node
+type NodeScore struct {
+	Node           string        `json:"node"`
+	Responsive     bool          `json:"responsive"`
+	LatencyMs      int64         `json:"latency_ms"`
+	CatchingUp     bool          `json:"catching_up"`
+	LagS           int64         `json:"lag_s"`
+	EarliestHeight int           `json:"earliest_height"`
+	TxIndexing     bool          `json:"tx_indexing"`
+	TxCounts       []AddrTxCount `json:"tx_counts"`
+	Error          string        `json:"error,omitempty"`
+	Score          float64       `json:"score"` //0: not usable for syncing; higher is better
+}
+
+type NetworkNodeScores struct {
+	SurveyedAt time.Time   `json:"surveyed_at"`
+	Nodes      []NodeScore `json:"nodes"`
+}
+
+// the survey fields of a probe (tx counts are added by the caller)
+func NewNodeScore(probe NodeProbe) NodeScore {
+	nodeScore := NodeScore{
+		Node:           probe.Node,
+		Responsive:     probe.Responsive(),
+		LatencyMs:      probe.Latency.Milliseconds(),
+		CatchingUp:     probe.CatchingUp,
+		LagS:           int64(probe.Lag.Seconds()),
+		EarliestHeight: probe.EarliestHeight,
+		TxIndexing:     probe.TxSearch,
+	}
+	if !probe.Responsive() {
+		nodeScore.Error = probe.Err.Error()
+	} else if !probe.TxSearch {
+		nodeScore.Error = probe.TxSearchErr
+	}
+	return nodeScore
+}
+
+// scores the surveyed nodes of a network: nodes not usable for syncing (not responsive, catching up, no tx indexing) get 0;
+// the others 100 for reporting the most txs for all addresses (pruned nodes report less), minus 10 per second latency (min 1)
+func ScoreNodes(nodeScores []NodeScore) {
+	maxCounts := map[string]int{}
+	for _, nodeScore := range nodeScores {
+		for _, txCount := range nodeScore.TxCounts {
+			if txCount.NodeCount > maxCounts[txCount.Addr] {
+				maxCounts[txCount.Addr] = txCount.NodeCount
+			}
+		}
+	}
+
+	for i := range nodeScores {
+		nodeScore := &nodeScores[i]
+		nodeScore.Score = 0
+		if !nodeScore.Responsive || nodeScore.CatchingUp || nodeScore.LagS >= int64(maxNodeLag.Seconds()) || !nodeScore.TxIndexing {
+			continue
+		}
+
+		completeness := 1.0
+		for _, txCount := range nodeScore.TxCounts {
+			if maxCounts[txCount.Addr] == 0 {
+				continue
+			}
+			if txCount.NodeCount < 0 {
+				completeness = 0
+				break
+			}
+			completeness = math.Min(completeness, float64(txCount.NodeCount)/float64(maxCounts[txCount.Addr]))
+		}
+
+		nodeScore.Score = math.Max(1, 100*completeness-float64(nodeScore.LatencyMs)/100)
+	}
+}
+
+// the cached survey results per network; empty if there is no cache yet
+func LoadNodeScores(pathFile string) map[string]NetworkNodeScores {
+	cache := map[string]NetworkNodeScores{}
+
+	if !utils.CheckFileExists(pathFile) {
+		return cache
+	}
+	data, err := os.ReadFile(pathFile)
+	utils.ErrDefaultFatal(err) //on err log.Fatal with details
+	err = json.Unmarshal(data, &cache)
+	if err != nil {
+		log.Println("	[W] ignoring unreadable node scores " + pathFile + ": " + err.Error())
+		return map[string]NetworkNodeScores{}
+	}
+	return cache
+}
+
+// stores the survey result of the networks in the cache, keeping the other networks' ones
+func SaveNodeScores(pathFile string, surveys map[string][]NodeScore) {
+	cache := LoadNodeScores(pathFile)
+	for chainName, nodeScores := range surveys {
+		cache[chainName] = NetworkNodeScores{SurveyedAt: time.Now().UTC(), Nodes: nodeScores}
+	}
+
+	data, err := json.MarshalIndent(cache, "", "  ")
+	utils.ErrDefaultFatal(err) //on err log.Fatal with details
+	err = os.WriteFile(pathFile, data, 0644)
+	utils.ErrDefaultFatal(err) //on err log.Fatal with details
+	log.Println("[OK] node scores cached in " + pathFile)
+}
+
+// writes the survey of all networks as json (same format as the cache) or csv (one row per node and address), by the file's extension
+func WriteNodeSurvey(pathFile string, surveys map[string][]NodeScore) {
+	var data []byte
+	var err error
+	var chainNames []string
+
+	for chainName := range surveys {
+		chainNames = append(chainNames, chainName)
+	}
+	sort.Strings(chainNames)
+
+	switch strings.ToLower(filepath.Ext(pathFile)) {
+	case ".json":
+		out := map[string]NetworkNodeScores{}
+		for _, chainName := range chainNames {
+			out[chainName] = NetworkNodeScores{SurveyedAt: time.Now().UTC(), Nodes: surveys[chainName]}
+		}
+		data, err = json.MarshalIndent(out, "", "  ")
+		utils.ErrDefaultFatal(err) //on err log.Fatal with details
+		err = os.WriteFile(pathFile, data, 0644)
+	case ".csv":
+		err = writeNodeSurveyCsv(pathFile, chainNames, surveys)
+	default:
+		log.Fatal("Unknown format of " + pathFile + ": use .json or .csv " + utils.FatalDetails())
+	}
+	utils.ErrDefaultFatal(err) //on err log.Fatal with details
+	log.Println("[OK] node survey written to " + pathFile)
+}
+
+func writeNodeSurveyCsv(pathFile string, chainNames []string, surveys map[string][]NodeScore) error {
+	file, err := os.Create(pathFile)
+	if err != nil {
+		return err
+	}
+	defer file.Close()
+
+	w := csv.NewWriter(file)
+	w.Write([]string{"network", "node", "responsive", "latency_ms", "catching_up", "lag_s", "earliest_height", "tx_indexing", "addr", "our_tx_count", "node_tx_count", "score", "error"})
+	for _, chainName := range chainNames {
+		for _, nodeScore := range surveys[chainName] {
+			row := []string{chainName, nodeScore.Node, strconv.FormatBool(nodeScore.Responsive), strconv.FormatInt(nodeScore.LatencyMs, 10),
+				strconv.FormatBool(nodeScore.CatchingUp), strconv.FormatInt(nodeScore.LagS, 10), strconv.Itoa(nodeScore.EarliestHeight),
+				strconv.FormatBool(nodeScore.TxIndexing)}
+			score := strconv.FormatFloat(nodeScore.Score, 'f', 1, 64)
+
+			//one row per address, a node not queried for the addresses gets one row without
+			if len(nodeScore.TxCounts) == 0 {
+				w.Write(append(row, "", "", "", score, nodeScore.Error))
+			}
+			for _, txCount := range nodeScore.TxCounts {
+				sError := nodeScore.Error
+				if txCount.Error != "" {
+					sError = txCount.Error
+				}
+				w.Write(append(row, txCount.Addr, strconv.Itoa(txCount.OurCount), strconv.Itoa(txCount.NodeCount), score, sError))
+			}
+		}
+	}
+	w.Flush()
+	return w.Error()
+}
+
+// orders nodes by the cached survey of the network: best score first, then the nodes not surveyed (as given),
+// the ones found not usable last
+func (chainI *ChainInfo) rankNodes(nodes []string) []string {
+	networkScores, ok := LoadNodeScores(NodeScoresFile)[chainI.ChainName]
+	if !ok || time.Since(networkScores.SurveyedAt) > maxNodeScoresAge {
+		return nodes
+	}
+
+	scores := map[string]float64{}
+	for _, nodeScore := range networkScores.Nodes {
+		scores[nodeScore.Node] = nodeScore.Score
+	}
+	rank := func(node string) float64 {
+		score, ok := scores[EnsurePortInAddress(node)]
+		if !ok {
+			return 0.5 //not surveyed: between the usable (>=1) and the not usable (0) ones
+		}
+		return score
+	}
+
+	ranked := append([]string{}, nodes...)
+	sort.SliceStable(ranked, func(i, j int) bool {
+		return rank(ranked[i]) > rank(ranked[j])
+	})
+	return ranked
+}
@@ -0,0 +1,338 @@
+// probe.go
+package network
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"log"
+	"os/exec"
+	"strconv"
+	"strings"
+	"time"
+
+	"alexp/stakingtax/pkg/configData"
+	"alexp/stakingtax/pkg/lcd"
+	"alexp/stakingtax/pkg/rpc"
+	"alexp/stakingtax/pkg/taxcsv"
+)
+
+// a node lagging more than this behind the chain is treated as catching up
+const maxNodeLag = 10 * time.Minute
+
+// what a node can do for our sync: responsive, synced, which blocks it still has and whether its txs are indexed
+type NodeProbe struct {
+	Node           string
+	Err            error         //not responsive (or serving another chain)
+	Latency        time.Duration //of the status request
+	CatchingUp     bool
+	LatestHeight   int
+	Lag            time.Duration //time since the latest block
+	EarliestHeight int           //>1 for pruned nodes
+	TxSearch       bool          //tx_search works, i.e. the node indexes txs
+	TxSearchErr    string
+}
+
+// daemon status json; older versions use upper case keys
+type daemonStatusSync struct {
+	LatestBlockHeight   string `json:"latest_block_height"`
+	LatestBlockTime     string `json:"latest_block_time"`
+	EarliestBlockHeight string `json:"earliest_block_height"`
+	CatchingUp          bool   `json:"catching_up"`
+}
+
+type daemonStatusNode struct {
+	Network string `json:"network"`
+}
+
+type daemonStatusFull struct {
+	NodeInfo    daemonStatusNode `json:"NodeInfo"`
+	NodeInfoNew daemonStatusNode `json:"node_info"`
+	SyncInfo    daemonStatusSync `json:"SyncInfo"`
+	SyncInfoNew daemonStatusSync `json:"sync_info"`
+}
+
+func (p *NodeProbe) Responsive() bool {
+	return p.Err == nil
+}
+
+// responsive, synced and indexing txs
+func (p *NodeProbe) Usable() bool {
+	return p.Responsive() && !p.CatchingUp && p.Lag < maxNodeLag && p.TxSearch
+}
+
+// usable and still having all blocks after our last synced height
+func (p *NodeProbe) Covers(lastHeight int) bool {
+	return p.Usable() && p.EarliestHeight <= lastHeight+1
+}
+
+// why the node is not good for our sync; "" if it covers our last synced height
+func (p *NodeProbe) Shortcoming(lastHeight int) string {
+	switch {
+	case !p.Responsive():
+		return "not responsive"
+	case p.CatchingUp:
+		return "catching up"
+	case p.Lag >= maxNodeLag:
+		return "lagging " + p.Lag.Round(time.Second).String() + " behind"
+	case !p.TxSearch:
+		return "no tx_search (tx indexing disabled?)"
+	case p.EarliestHeight > lastHeight+1:
+		return "pruned: earliest height " + strconv.Itoa(p.EarliestHeight) + " is above our last synced height " + strconv.Itoa(lastHeight)
+	}
+	return ""
+}
+
+func (p *NodeProbe) String() string {
+	if !p.Responsive() {
+		return "not responsive: " + p.Err.Error()
+	}
+	s := "latency: " + p.Latency.Round(time.Millisecond).String() +
+		", catching_up: " + strconv.FormatBool(p.CatchingUp) +
+		", lag: " + p.Lag.Round(time.Second).String() +
+		", earliest height: " + strconv.Itoa(p.EarliestHeight) +
+		", tx_search: "
+	if p.TxSearch {
+		return s + "ok"
+	}
+	return s + "failed (" + p.TxSearchErr + ")"
+}
+
+// latest block height and time as given by the node
+func (p *NodeProbe) setLatest(sHeight string, sTime string) error {
+	var err error
+	p.LatestHeight, err = strconv.Atoi(sHeight)
+	if err != nil {
+		return err
+	}
+	t, err := time.Parse(time.RFC3339Nano, sTime)
+	if err != nil {
+		return err
+	}
+	p.Lag = time.Since(t)
+	if p.Lag < 0 {
+		p.Lag = 0
+	}
+	return nil
+}
+
+// a recent height to test tx_search with (the latest block may not be indexed yet)
+func (p *NodeProbe) txSearchHeight() string {
+	if p.LatestHeight > 1 {
+		return strconv.Itoa(p.LatestHeight - 1)
+	}
+	return "1"
+}
+
+func (p *NodeProbe) setTxSearch(err error) {
+	p.TxSearch = err == nil
+	if err != nil {
+		p.TxSearchErr = firstLine(err.Error())
+	}
+}
+
+func firstLine(s string) string {
+	s = strings.TrimSpace(s)
+	if i := strings.IndexByte(s, '\n'); i >= 0 {
+		return s[:i]
+	}
+	return s
+}
+
+// probes a node with the method of the network's backend
+func (chainI *ChainInfo) ProbeNode(currAddr string, tcheckAddChannel bool) NodeProbe {
+	finalAddr := currAddr
+	if tcheckAddChannel {
+		finalAddr = EnsurePortInAddress(currAddr)
+	}
+
+	switch chainI.Backend {
+	case BackendRpc:
+		return ProbeNodeRpc(chainI.ChainId, finalAddr)
+	case BackendLcd:
+		return ProbeNodeLcd(chainI.ChainId, finalAddr)
+	default:
+		return ProbeNodeDaemon(chainI.DaemonName, chainI.ChainId, finalAddr)
+	}
+}
+
+// probes a node via the daemon's status and query txs ("" for the daemon's config node)
+func ProbeNodeDaemon(daemonName string, chainId string, node string) NodeProbe {
+	probe := NodeProbe{Node: node}
+
+	run := func(args ...string) ([]byte, error) {
+		if node != "" {
+			args = append([]string{"--node", node}, args...)
+		}
+		ctx, cancel := context.WithTimeout(context.Background(), 15*time.Second)
+		defer cancel()
+		out, err := exec.CommandContext(ctx, daemonName, args...).CombinedOutput() //older versions print the status to stderr
+		if err != nil {
+			return nil, fmt.Errorf("%w; %v", err, string(out))
+		}
+		return out, nil
+	}
+
+	tStart := time.Now()
+	out, err := run("status")
+	probe.Latency = time.Since(tStart)
+	if err != nil {
+		probe.Err = errors.New(firstLine(err.Error()))
+		return probe
+	}
+
+	status := daemonStatusFull{}
+	err = json.Unmarshal(out, &status)
+	if err != nil {
+		probe.Err = err
+		return probe
+	}
+	nodeInfo, syncInfo := status.NodeInfo, status.SyncInfo
+	if syncInfo.LatestBlockHeight == "" {
+		nodeInfo, syncInfo = status.NodeInfoNew, status.SyncInfoNew
+	}
+	if nodeInfo.Network != chainId {
+		probe.Err = errors.New("serves chain-id " + nodeInfo.Network + " instead of " + chainId)
+		return probe
+	}
+
+	probe.CatchingUp = syncInfo.CatchingUp
+	probe.EarliestHeight, _ = strconv.Atoi(syncInfo.EarliestBlockHeight)
+	err = probe.setLatest(syncInfo.LatestBlockHeight, syncInfo.LatestBlockTime)
+	if err != nil {
+		probe.Err = err
+		return probe
+	}
+
+	_, err = run("query", "txs", "--events", "'tx.height="+probe.txSearchHeight()+"'", "--page", "1", "--limit", "1", "-out", "json")
+	probe.setTxSearch(err)
+	return probe
+} //ProbeNodeDaemon
+
+// probes a node via its json-rpc
+func ProbeNodeRpc(chainId string, node string) NodeProbe {
+	probe := NodeProbe{Node: node}
+	client := rpc.NewClient(node, 15*time.Second)
+
+	tStart := time.Now()
+	status, err := client.Status()
+	probe.Latency = time.Since(tStart)
+	if err != nil {
+		probe.Err = err
+		return probe
+	}
+	if status.NodeInfo.Network != chainId {
+		probe.Err = errors.New("serves chain-id " + status.NodeInfo.Network + " instead of " + chainId)
+		return probe
+	}
+
+	probe.CatchingUp = status.SyncInfo.CatchingUp
+	probe.EarliestHeight, _ = strconv.Atoi(status.SyncInfo.EarliestBlockHeight)
+	err = probe.setLatest(status.SyncInfo.LatestBlockHeight, status.SyncInfo.LatestBlockTime)
+	if err != nil {
+		probe.Err = err
+		return probe
+	}
+
+	_, err = client.TxSearch("tx.height="+probe.txSearchHeight(), 1, 1)
+	probe.setTxSearch(err)
+	return probe
+} //ProbeNodeRpc
+
+// probes a node via its rest api (lcd)
+func ProbeNodeLcd(chainId string, node string) NodeProbe {
+	probe := NodeProbe{Node: node}
+	client := lcd.NewClient(node, 15*time.Second)
+
+	tStart := time.Now()
+	nodeInfo, err := client.NodeInfo()
+	probe.Latency = time.Since(tStart)
+	if err != nil {
+		probe.Err = err
+		return probe
+	}
+	if nodeInfo.DefaultNodeInfo.Network != chainId {
+		probe.Err = errors.New("serves chain-id " + nodeInfo.DefaultNodeInfo.Network + " instead of " + chainId)
+		return probe
+	}
+
+	probe.CatchingUp, err = client.Syncing()
+	if err == nil {
+		var sHeight, sTime string
+		sHeight, sTime, err = client.LatestBlock()
+		if err == nil {
+			err = probe.setLatest(sHeight, sTime)
+		}
+	}
+	if err == nil {
+		probe.EarliestHeight, err = client.EarliestHeight()
+	}
+	if err != nil {
+		probe.Err = err
+		return probe
+	}
+
+	_, err = client.TxsEvent([]string{"tx.height=" + probe.txSearchHeight()}, 1, 1)
+	probe.setTxSearch(err)
+	return probe
+} //ProbeNodeLcd
+
+// probes the given nodes (adding a port if missing) until one covers our last synced height; if none does, the usable one
+// with the lowest earliest height, else the first responsive one. prev is a node probed before (e.g. the config node, nil
+// if none) to compare with. Returns the address to use or "" if no node responded.
+func (chainI *ChainInfo) selectNode(nodes []string, lastHeight int, prev *NodeProbe) string {
+	var best *NodeProbe
+	var firstResponsive string
+
+	if prev != nil && prev.Responsive() {
+		firstResponsive = prev.Node
+		if prev.Usable() {
+			best = prev
+		}
+	}
+
+	for _, v := range nodes {
+		probe := chainI.ProbeNode(v, true) //true: check channel
+		log.Println("	" + probe.Node + ": " + probe.String())
+		if probe.Covers(lastHeight) {
+			log.Println("	[OK] -> " + probe.Node + " covers our last synced height " + strconv.Itoa(lastHeight))
+			return probe.Node
+		}
+		if firstResponsive == "" && probe.Responsive() {
+			firstResponsive = probe.Node
+		}
+		if probe.Usable() && (best == nil || probe.EarliestHeight < best.EarliestHeight) {
+			best = &probe
+		}
+	}
+
+	if best != nil {
+		log.Println("	[W] no node covers our last synced height -> using " + best.Node + ", " + best.Shortcoming(lastHeight))
+		return best.Node
+	}
+	if firstResponsive != "" {
+		log.Println("	[W] no node is synced and indexing txs -> using the responsive " + firstResponsive)
+	}
+	return firstResponsive
+} //selectNode
+
+// the height all addresses of the network are synced to (the lowest of their csv files); nodes pruned above it miss txs
+func lastSyncedHeight(cfgAdr *configData.CfgAdr, chainName string) int {
+	lastHeight := -1
+	for _, addresses := range cfgAdr.Addresses {
+		if addresses.ChainName != chainName {
+			continue
+		}
+		for _, v := range addresses.AddrList {
+			blockHeight := taxcsv.GetLastBlockHeight(chainName + "_" + v.Addr + ".csv")
+			if lastHeight < 0 || blockHeight < lastHeight {
+				lastHeight = blockHeight
+			}
+		}
+	}
+	if lastHeight < 0 {
+		return 0
+	}
+	return lastHeight
+}
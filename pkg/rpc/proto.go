@@ -0,0 +1,365 @@
+// proto.go
+package rpc
+
+import (
+	"alexp/stakingtax/pkg/address"
+	"encoding/base64"
+	"encoding/binary"
+	"errors"
+)
+
+// /tx_search returns the tx as base64 encoded protobuf (cosmos.tx.v1beta1.TxRaw). To not pull in the whole
+// cosmos-sdk, we decode only the few fields we need by walking the protobuf wire format ourselves.
+
+type Coin struct {
+	Denom  string
+	Amount string
+}
+
+type Any struct {
+	TypeUrl string
+	Value   []byte
+}
+
+type DecodedTx struct {
+	Messages      []Any
+	SignerPubKeys []string //base64, as the daemons print them
+	FeeAmount     []Coin
+	FeePayer      string
+	FeeGranter    string
+}
+
+var errProtoTruncated = errors.New("protobuf data truncated")
+
+// one decoded field of a protobuf message; for wire type 0 (varint) Num is set, for 2 (length-delimited) Bytes
+type protoField struct {
+	Field int
+	Num   uint64
+	Bytes []byte
+}
+
+func readVarint(b []byte) (uint64, int, error) {
+	var v uint64
+	for i := 0; i < len(b) && i < 10; i++ {
+		v |= uint64(b[i]&0x7f) << (7 * uint(i))
+		if b[i] < 0x80 {
+			return v, i + 1, nil
+		}
+	}
+	return 0, 0, errProtoTruncated
+}
+
+// splits a protobuf message into its (top level) fields
+func parseProtoFields(b []byte) ([]protoField, error) {
+	var fields []protoField
+	for len(b) > 0 {
+		key, n, err := readVarint(b)
+		if err != nil {
+			return nil, err
+		}
+		b = b[n:]
+
+		f := protoField{Field: int(key >> 3)}
+		switch key & 7 {
+		case 0: //varint
+			f.Num, n, err = readVarint(b)
+			if err != nil {
+				return nil, err
+			}
+			b = b[n:]
+		case 1: //fixed64
+			if len(b) < 8 {
+				return nil, errProtoTruncated
+			}
+			b = b[8:]
+		case 2: //length-delimited
+			l, n, err := readVarint(b)
+			if err != nil {
+				return nil, err
+			}
+			b = b[n:]
+			if uint64(len(b)) < l {
+				return nil, errProtoTruncated
+			}
+			f.Bytes = b[:l]
+			b = b[l:]
+		case 5: //fixed32
+			if len(b) < 4 {
+				return nil, errProtoTruncated
+			}
+			b = b[4:]
+		default:
+			return nil, errors.New("unsupported protobuf wire type")
+		}
+		fields = append(fields, f)
+	}
+	return fields, nil
+}
+
+func decodeAny(b []byte) (Any, error) {
+	a := Any{}
+	fields, err := parseProtoFields(b)
+	if err != nil {
+		return a, err
+	}
+	for _, f := range fields {
+		switch f.Field {
+		case 1:
+			a.TypeUrl = string(f.Bytes)
+		case 2:
+			a.Value = f.Bytes
+		}
+	}
+	return a, nil
+}
+
+func decodeCoin(b []byte) (Coin, error) {
+	c := Coin{}
+	fields, err := parseProtoFields(b)
+	if err != nil {
+		return c, err
+	}
+	for _, f := range fields {
+		switch f.Field {
+		case 1:
+			c.Denom = string(f.Bytes)
+		case 2:
+			c.Amount = string(f.Bytes)
+		}
+	}
+	return c, nil
+}
+
+// decodes the base64 TxRaw as returned by /tx_search
+func DecodeTx(txB64 string) (*DecodedTx, error) {
+	raw, err := base64.StdEncoding.DecodeString(txB64)
+	if err != nil {
+		return nil, err
+	}
+
+	dTx := &DecodedTx{}
+
+	//TxRaw: body_bytes=1, auth_info_bytes=2, signatures=3
+	txFields, err := parseProtoFields(raw)
+	if err != nil {
+		return nil, err
+	}
+	for _, txF := range txFields {
+		switch txF.Field {
+		case 1:
+			err = decodeBody(txF.Bytes, dTx)
+		case 2:
+			err = decodeAuthInfo(txF.Bytes, dTx)
+		}
+		if err != nil {
+			return nil, err
+		}
+	}
+
+	return dTx, nil
+}
+
+// TxBody: messages=1 (repeated Any), memo=2, timeout_height=3, ...
+func decodeBody(b []byte, dTx *DecodedTx) error {
+	fields, err := parseProtoFields(b)
+	if err != nil {
+		return err
+	}
+	for _, f := range fields {
+		if f.Field == 1 {
+			msg, err := decodeAny(f.Bytes)
+			if err != nil {
+				return err
+			}
+			dTx.Messages = append(dTx.Messages, msg)
+		}
+	}
+	return nil
+}
+
+// AuthInfo: signer_infos=1 (repeated SignerInfo{public_key=1 Any}), fee=2 (Fee{amount=1 repeated Coin, gas_limit=2, payer=3, granter=4})
+func decodeAuthInfo(b []byte, dTx *DecodedTx) error {
+	fields, err := parseProtoFields(b)
+	if err != nil {
+		return err
+	}
+	for _, f := range fields {
+		switch f.Field {
+		case 1:
+			signerFields, err := parseProtoFields(f.Bytes)
+			if err != nil {
+				return err
+			}
+			pubKey := ""
+			for _, sf := range signerFields {
+				if sf.Field != 1 {
+					continue
+				}
+				pubKey, err = decodePubKey(sf.Bytes)
+				if err != nil {
+					return err
+				}
+			}
+			dTx.SignerPubKeys = append(dTx.SignerPubKeys, pubKey)
+		case 2:
+			feeFields, err := parseProtoFields(f.Bytes)
+			if err != nil {
+				return err
+			}
+			for _, ff := range feeFields {
+				switch ff.Field {
+				case 1:
+					coin, err := decodeCoin(ff.Bytes)
+					if err != nil {
+						return err
+					}
+					dTx.FeeAmount = append(dTx.FeeAmount, coin)
+				case 3:
+					dTx.FeePayer = string(ff.Bytes)
+				case 4:
+					dTx.FeeGranter = string(ff.Bytes)
+				}
+			}
+		}
+	}
+	return nil
+}
+
+// the base64 key of a public key Any; all single key types (secp256k1, ed25519, ethsecp256k1) carry the key in field 1
+func decodePubKey(b []byte) (string, error) {
+	pkAny, err := decodeAny(b)
+	if err != nil {
+		return "", err
+	}
+	pkFields, err := parseProtoFields(pkAny.Value)
+	if err != nil {
+		return "", err
+	}
+	for _, pkf := range pkFields {
+		if pkf.Field == 1 && len(pkf.Bytes) > 0 {
+			return base64.StdEncoding.EncodeToString(pkf.Bytes), nil
+		}
+	}
+	return "", nil
+}
+
+// authz MsgExec: grantee=1, msgs=2 (repeated Any)
+func DecodeMsgExec(b []byte) (string, []Any, error) {
+	var grantee string
+	var msgs []Any
+
+	fields, err := parseProtoFields(b)
+	if err != nil {
+		return "", nil, err
+	}
+	for _, f := range fields {
+		switch f.Field {
+		case 1:
+			grantee = string(f.Bytes)
+		case 2:
+			msg, err := decodeAny(f.Bytes)
+			if err != nil {
+				return "", nil, err
+			}
+			msgs = append(msgs, msg)
+		}
+	}
+	return grantee, msgs, nil
+}
+
+// the delegator and validator address of staking and distribution messages; empty for other messages
+func StakingAddresses(msg Any) (string, string) {
+	var delegatorField, validatorField int
+
+	switch msg.TypeUrl {
+	case "/cosmos.staking.v1beta1.MsgDelegate", "/cosmos.staking.v1beta1.MsgUndelegate",
+		"/cosmos.staking.v1beta1.MsgCancelUnbondingDelegation", "/cosmos.distribution.v1beta1.MsgWithdrawDelegatorReward":
+		delegatorField, validatorField = 1, 2
+	case "/cosmos.staking.v1beta1.MsgBeginRedelegate", "/cosmos.distribution.v1beta1.MsgSetWithdrawAddress":
+		delegatorField = 1
+	case "/cosmos.distribution.v1beta1.MsgWithdrawValidatorCommission":
+		validatorField = 1
+	default:
+		return "", ""
+	}
+
+	var delegator, validator string
+	fields, err := parseProtoFields(msg.Value)
+	if err != nil {
+		return "", ""
+	}
+	for _, f := range fields {
+		switch f.Field {
+		case delegatorField:
+			delegator = string(f.Bytes)
+		case validatorField:
+			validator = string(f.Bytes)
+		}
+	}
+	return delegator, validator
+}
+
+// QueryAccountRequest: address=1
+func EncodeQueryAccountRequest(addr string) []byte {
+	b := []byte{1<<3 | 2}
+	b = appendUvarint(b, uint64(len(addr)))
+	return append(b, addr...)
+}
+
+// appends v in varint encoding
+func appendUvarint(b []byte, v uint64) []byte {
+	var buf [binary.MaxVarintLen64]byte
+	return append(b, buf[:binary.PutUvarint(buf[:], v)]...)
+}
+
+// QueryAccountResponse: account=1 (Any). BaseAccount: address=1, pub_key=2 (Any); the other account types
+// (vesting, ethermint's EthAccount) embed their base account in field 1, possibly nested
+// (ContinuousVestingAccount{base_vesting_account=1{base_account=1}}). "" if the account has no pubkey yet.
+func DecodeAccountPubKey(b []byte) (string, error) {
+	fields, err := parseProtoFields(b)
+	if err != nil {
+		return "", err
+	}
+	for _, f := range fields {
+		if f.Field != 1 {
+			continue
+		}
+		account, err := decodeAny(f.Bytes)
+		if err != nil {
+			return "", err
+		}
+		return decodeBaseAccountPubKey(account.Value, 0)
+	}
+	return "", nil
+}
+
+// the base account is the message whose field 1 is the (bech32) address, wrappers hold a message there
+func decodeBaseAccountPubKey(b []byte, depth int) (string, error) {
+	fields, err := parseProtoFields(b)
+	if err != nil {
+		return "", err
+	}
+
+	var embedded []byte
+	tBaseAccount := false
+	for _, f := range fields {
+		if f.Field == 1 {
+			embedded = f.Bytes
+			_, _, err = address.Decode(string(f.Bytes))
+			tBaseAccount = err == nil
+		}
+	}
+
+	if tBaseAccount {
+		for _, f := range fields {
+			if f.Field == 2 {
+				return decodePubKey(f.Bytes)
+			}
+		}
+		return "", nil
+	}
+	if embedded == nil || depth >= 3 {
+		return "", errors.New("no base account found in account")
+	}
+	return decodeBaseAccountPubKey(embedded, depth+1)
+}
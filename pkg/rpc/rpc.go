@@ -0,0 +1,252 @@
+// rpc.go
+package rpc
+
+import (
+	"encoding/base64"
+	"encoding/hex"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io/ioutil"
+	"net/http"
+	"net/url"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+)
+
+// minimal Tendermint JSON-RPC client (URI over HTTP), covering only the endpoints we need:
+// /status, /tx_search, /block (for the timestamp of a tx) and /abci_query (for the account's pubkey)
+type Client struct {
+	Addr       string
+	HttpClient *http.Client
+	blockTimes map[int]string //cache height -> block time, as several txs often share a block
+	mu         sync.Mutex     //guards blockTimes, the client is shared by the workers syncing a network's addresses
+}
+
+type Attribute struct {
+	Key   string `json:"key"`
+	Value string `json:"value"`
+}
+
+type Event struct {
+	Type       string      `json:"type"`
+	Attributes []Attribute `json:"attributes"`
+}
+
+type StatusResp struct {
+	NodeInfo struct {
+		Network string `json:"network"`
+		Version string `json:"version"`
+	} `json:"node_info"`
+	SyncInfo struct {
+		LatestBlockHeight   string `json:"latest_block_height"`
+		LatestBlockTime     string `json:"latest_block_time"`
+		EarliestBlockHeight string `json:"earliest_block_height"`
+		CatchingUp          bool   `json:"catching_up"`
+	} `json:"sync_info"`
+}
+
+type TxSearchResp struct {
+	Txs []struct {
+		Hash     string `json:"hash"`
+		Height   string `json:"height"`
+		Index    int    `json:"index"`
+		TxResult struct {
+			Code   int     `json:"code"`
+			Log    string  `json:"log"`
+			Events []Event `json:"events"`
+		} `json:"tx_result"`
+		Tx string `json:"tx"` //base64 encoded protobuf TxRaw
+	} `json:"txs"`
+	TotalCount string `json:"total_count"`
+}
+
+type blockResp struct {
+	Block struct {
+		Header struct {
+			ChainId string `json:"chain_id"`
+			Height  string `json:"height"`
+			Time    string `json:"time"`
+		} `json:"header"`
+	} `json:"block"`
+}
+
+type abciQueryResp struct {
+	Response struct {
+		Code      int    `json:"code"`
+		Codespace string `json:"codespace"`
+		Log       string `json:"log"`
+		Value     string `json:"value"` //base64 encoded protobuf response
+	} `json:"response"`
+}
+
+// codes of the sdk's root codespace for unknown entities: ErrUnknownAddress, ErrKeyNotFound (grpc NotFound is mapped to it)
+const (
+	sdkCodeUnknownAddress = 22
+	sdkCodeKeyNotFound    = 38
+)
+
+// a grpc query via /abci_query the app answered with an error code
+type AbciError struct {
+	Path      string
+	Code      int
+	Codespace string
+	Log       string
+}
+
+func (e *AbciError) Error() string {
+	return fmt.Sprintf("abci_query %s failed: %s (code %d)", e.Path, e.Log, e.Code)
+}
+
+// did the app answer that the requested entity does not exist?
+func IsNotFound(err error) bool {
+	var abciErr *AbciError
+	if !errors.As(err, &abciErr) {
+		return false
+	}
+	return abciErr.Codespace == "sdk" && (abciErr.Code == sdkCodeKeyNotFound || abciErr.Code == sdkCodeUnknownAddress)
+}
+
+// json-rpc envelope
+type rpcResp struct {
+	Result json.RawMessage `json:"result"`
+	Error  *struct {
+		Code    int    `json:"code"`
+		Message string `json:"message"`
+		Data    string `json:"data"`
+	} `json:"error"`
+}
+
+func NewClient(addr string, timeout time.Duration) *Client {
+	return &Client{
+		Addr:       strings.TrimSuffix(addr, "/"),
+		HttpClient: &http.Client{Timeout: timeout},
+		blockTimes: map[int]string{},
+	}
+}
+
+// GET addr/method?params and unmarshal the json-rpc result into result
+func (c *Client) call(method string, params url.Values, result interface{}) error {
+	u := c.Addr + "/" + method
+	if len(params) > 0 {
+		u += "?" + params.Encode()
+	}
+
+	res, err := c.HttpClient.Get(u)
+	if err != nil {
+		return err
+	}
+	defer res.Body.Close()
+
+	body, err := ioutil.ReadAll(res.Body)
+	if err != nil {
+		return err
+	}
+
+	rpcR := rpcResp{}
+	err = json.Unmarshal(body, &rpcR)
+	if err != nil {
+		return fmt.Errorf("%w; %s returned statusCode: %d", err, method, res.StatusCode)
+	}
+	if rpcR.Error != nil {
+		return fmt.Errorf("%s failed: %v %v (code %d)", method, rpcR.Error.Message, rpcR.Error.Data, rpcR.Error.Code)
+	}
+	if res.StatusCode != 200 {
+		return fmt.Errorf("%s failed with statusCode: %d and status %s", method, res.StatusCode, res.Status)
+	}
+
+	return json.Unmarshal(rpcR.Result, result)
+}
+
+func (c *Client) Status() (*StatusResp, error) {
+	statusR := &StatusResp{}
+	err := c.call("status", nil, statusR)
+	if err != nil {
+		return nil, err
+	}
+	return statusR, nil
+}
+
+// query is a tendermint event query like message.sender='addr' AND tx.height>=5; txs are returned in ascending order
+func (c *Client) TxSearch(query string, page int, perPage int) (*TxSearchResp, error) {
+	params := url.Values{}
+	params.Set("query", "\""+query+"\"")
+	params.Set("page", strconv.Itoa(page))
+	params.Set("per_page", strconv.Itoa(perPage))
+	params.Set("order_by", "\"asc\"")
+
+	txSearchR := &TxSearchResp{}
+	err := c.call("tx_search", params, txSearchR)
+	if err != nil {
+		return nil, err
+	}
+	return txSearchR, nil
+}
+
+// earliest block height the node still has (>1 for pruned nodes)
+func (c *Client) EarliestHeight() (int, error) {
+	status, err := c.Status()
+	if err != nil {
+		return 0, err
+	}
+	return strconv.Atoi(status.SyncInfo.EarliestBlockHeight)
+}
+
+// returns the block time of the given height in the format the daemons use (RFC3339, seconds precision)
+func (c *Client) BlockTime(height int) (string, error) {
+	c.mu.Lock()
+	t, ok := c.blockTimes[height]
+	c.mu.Unlock()
+	if ok {
+		return t, nil
+	}
+
+	params := url.Values{}
+	params.Set("height", strconv.Itoa(height))
+
+	blockR := &blockResp{}
+	err := c.call("block", params, blockR)
+	if err != nil {
+		return "", err
+	}
+
+	bt, err := time.Parse(time.RFC3339Nano, blockR.Block.Header.Time)
+	if err != nil {
+		return "", err
+	}
+
+	sTime := bt.UTC().Format("2006-01-02T15:04:05Z")
+	c.mu.Lock()
+	c.blockTimes[height] = sTime
+	c.mu.Unlock()
+	return sTime, nil
+}
+
+// runs a grpc query (path like /cosmos.auth.v1beta1.Query/Account) with the protobuf encoded request via /abci_query,
+// returns the protobuf encoded response
+func (c *Client) AbciQuery(path string, data []byte) ([]byte, error) {
+	params := url.Values{}
+	params.Set("path", "\""+path+"\"")
+	params.Set("data", "0x"+hex.EncodeToString(data))
+
+	abciQueryR := &abciQueryResp{}
+	err := c.call("abci_query", params, abciQueryR)
+	if err != nil {
+		return nil, err
+	}
+	if abciQueryR.Response.Code != 0 {
+		return nil, &AbciError{Path: path, Code: abciQueryR.Response.Code, Codespace: abciQueryR.Response.Codespace, Log: abciQueryR.Response.Log}
+	}
+	return base64.StdEncoding.DecodeString(abciQueryR.Response.Value)
+}
+
+// the account's pubkey (base64) via the auth module; "" if the account has no pubkey (never signed a tx)
+func (c *Client) AccountPubKey(addr string) (string, error) {
+	resp, err := c.AbciQuery("/cosmos.auth.v1beta1.Query/Account", EncodeQueryAccountRequest(addr))
+	if err != nil {
+		return "", err
+	}
+	return DecodeAccountPubKey(resp)
+}
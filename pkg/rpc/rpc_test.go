@@ -0,0 +1,217 @@
+package rpc
+
+import (
+	"bytes"
+	"encoding/base64"
+	"fmt"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+	"time"
+)
+
+const (
+	testAddr      = "cosmos1ycv7ag92g3v4gmd7fsf9jjsz527qwpr3cd8pqn"
+	testValidator = "cosmosvaloper1sjllsnramtg3ewxqwwrwjxfgc4n4ef9u2lcnj0"
+	testGranter   = "cosmos1a8kt5tmjlxm6zlm8ystd8nt3ggkd8m9gf3vmxs"
+)
+
+// protobuf wire format, for building a TxRaw as the chain encodes it
+func pbBytes(field int, b []byte) []byte {
+	out := appendUvarint(nil, uint64(field<<3|2))
+	out = appendUvarint(out, uint64(len(b)))
+	return append(out, b...)
+}
+
+func pbVarint(field int, v uint64) []byte {
+	out := appendUvarint(nil, uint64(field<<3))
+	return appendUvarint(out, v)
+}
+
+func pbAny(field int, typeUrl string, value []byte) []byte {
+	return pbBytes(field, append(pbBytes(1, []byte(typeUrl)), pbBytes(2, value)...))
+}
+
+func join(parts ...[]byte) []byte {
+	return bytes.Join(parts, nil)
+}
+
+// a signed MsgWithdrawDelegatorReward tx (TxRaw: body, auth info, signature) and the signer's pubkey
+func testTxRaw() (string, []byte) {
+	pubKey := append([]byte{0x02}, bytes.Repeat([]byte{0xab}, 32)...)
+
+	msg := join(pbBytes(1, []byte(testAddr)), pbBytes(2, []byte(testValidator)))
+	body := join(pbAny(1, "/cosmos.distribution.v1beta1.MsgWithdrawDelegatorReward", msg), pbBytes(2, []byte("memo")))
+
+	signerInfo := join(
+		pbAny(1, "/cosmos.crypto.secp256k1.PubKey", pbBytes(1, pubKey)),
+		pbBytes(2, pbBytes(1, pbVarint(1, 1))), //mode_info{single{mode: direct}}
+		pbVarint(3, 42),                        //sequence
+	)
+	fee := join(
+		pbBytes(1, join(pbBytes(1, []byte("uatom")), pbBytes(2, []byte("5000")))),
+		pbVarint(2, 200000), //gas_limit
+		pbBytes(4, []byte(testGranter)),
+	)
+	authInfo := join(pbBytes(1, signerInfo), pbBytes(2, fee))
+
+	txRaw := join(pbBytes(1, body), pbBytes(2, authInfo), pbBytes(3, bytes.Repeat([]byte{0x01}, 64)))
+	return base64.StdEncoding.EncodeToString(txRaw), pubKey
+}
+
+func b64(s string) string {
+	return base64.StdEncoding.EncodeToString([]byte(s))
+}
+
+// stand-in node answering /status, /tx_search and /block like a tendermint 0.34 node with base64 encoded event attributes
+func newTestNode(t *testing.T, txB64 string, blockCalls *int) *httptest.Server {
+	return httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		q := r.URL.Query()
+		switch r.URL.Path {
+		case "/status":
+			fmt.Fprint(w, `{"jsonrpc":"2.0","id":-1,"result":{"node_info":{"network":"cosmoshub-4","version":"0.34.27"},
+				"sync_info":{"latest_block_height":"15000000","latest_block_time":"2023-04-01T10:00:00.123456789Z","earliest_block_height":"5200791","catching_up":false}}}`)
+		case "/tx_search":
+			if got := q.Get("query"); got != `"message.sender='`+testAddr+`' AND tx.height>=100"` {
+				t.Errorf("tx_search query = %s", got)
+			}
+			if q.Get("page") != "2" || q.Get("per_page") != "30" || q.Get("order_by") != `"asc"` {
+				t.Errorf("tx_search paging = page %s, per_page %s, order_by %s", q.Get("page"), q.Get("per_page"), q.Get("order_by"))
+			}
+			fmt.Fprintf(w, `{"jsonrpc":"2.0","id":-1,"result":{"txs":[{"hash":"ABCDEF","height":"123","index":0,
+				"tx_result":{"code":0,"log":"[]","events":[{"type":"coin_received","attributes":[
+				{"key":"%s","value":"%s","index":true},{"key":"%s","value":"%s","index":true}]}]},
+				"tx":"%s"}],"total_count":"31"}}`, b64("receiver"), b64(testAddr), b64("amount"), b64("12uatom"), txB64)
+		case "/block":
+			*blockCalls++
+			if q.Get("height") != "123" {
+				t.Errorf("block height = %s", q.Get("height"))
+			}
+			fmt.Fprint(w, `{"jsonrpc":"2.0","id":-1,"result":{"block":{"header":{"chain_id":"cosmoshub-4","height":"123","time":"2023-03-30T08:15:42.987654321Z"}}}}`)
+		case "/abci_query":
+			fmt.Fprint(w, `{"jsonrpc":"2.0","id":-1,"result":{"response":{"code":38,"log":"account `+testAddr+` not found: key not found","codespace":"sdk"}}}`)
+		default:
+			w.WriteHeader(http.StatusNotFound)
+			fmt.Fprint(w, `{"jsonrpc":"2.0","id":-1,"error":{"code":-32601,"message":"Method not found","data":""}}`)
+		}
+	}))
+}
+
+func TestStatus(t *testing.T) {
+	var blockCalls int
+	node := newTestNode(t, "", &blockCalls)
+	defer node.Close()
+	client := NewClient(node.URL+"/", 5*time.Second)
+
+	status, err := client.Status()
+	if err != nil {
+		t.Fatal(err)
+	}
+	if status.NodeInfo.Network != "cosmoshub-4" || status.SyncInfo.LatestBlockHeight != "15000000" || status.SyncInfo.CatchingUp {
+		t.Errorf("status = %+v", status)
+	}
+
+	earliest, err := client.EarliestHeight()
+	if err != nil || earliest != 5200791 {
+		t.Errorf("EarliestHeight() = %v, %v; want 5200791", earliest, err)
+	}
+}
+
+func TestTxSearch(t *testing.T) {
+	var blockCalls int
+	txB64, pubKey := testTxRaw()
+	node := newTestNode(t, txB64, &blockCalls)
+	defer node.Close()
+	client := NewClient(node.URL, 5*time.Second)
+
+	resp, err := client.TxSearch("message.sender='"+testAddr+"' AND tx.height>=100", 2, 30)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if resp.TotalCount != "31" || len(resp.Txs) != 1 {
+		t.Fatalf("total_count %s with %d txs, want 31 with 1", resp.TotalCount, len(resp.Txs))
+	}
+	tx := resp.Txs[0]
+	if tx.Hash != "ABCDEF" || tx.Height != "123" || tx.TxResult.Code != 0 {
+		t.Errorf("tx = %+v", tx)
+	}
+
+	//the attributes are returned as the node sends them (base64 for tendermint 0.34), they are decoded when processing the txs
+	attrs := tx.TxResult.Events[0].Attributes
+	if len(attrs) != 2 || attrs[0].Key != b64("receiver") || attrs[1].Value != b64("12uatom") {
+		t.Fatalf("attributes = %+v", attrs)
+	}
+	value, err := base64.StdEncoding.DecodeString(attrs[0].Value)
+	if err != nil || string(value) != testAddr {
+		t.Errorf("receiver decodes to %q, %v", value, err)
+	}
+
+	dTx, err := DecodeTx(tx.Tx)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(dTx.Messages) != 1 || dTx.Messages[0].TypeUrl != "/cosmos.distribution.v1beta1.MsgWithdrawDelegatorReward" {
+		t.Fatalf("messages = %+v", dTx.Messages)
+	}
+	delegator, validator := StakingAddresses(dTx.Messages[0])
+	if delegator != testAddr || validator != testValidator {
+		t.Errorf("StakingAddresses() = %s, %s", delegator, validator)
+	}
+	if len(dTx.SignerPubKeys) != 1 || dTx.SignerPubKeys[0] != base64.StdEncoding.EncodeToString(pubKey) {
+		t.Errorf("signer pubkeys = %v", dTx.SignerPubKeys)
+	}
+	if len(dTx.FeeAmount) != 1 || dTx.FeeAmount[0] != (Coin{Denom: "uatom", Amount: "5000"}) {
+		t.Errorf("fee = %+v", dTx.FeeAmount)
+	}
+	if dTx.FeePayer != "" || dTx.FeeGranter != testGranter {
+		t.Errorf("fee payer %q, granter %q", dTx.FeePayer, dTx.FeeGranter)
+	}
+}
+
+func TestBlockTime(t *testing.T) {
+	var blockCalls int
+	node := newTestNode(t, "", &blockCalls)
+	defer node.Close()
+	client := NewClient(node.URL, 5*time.Second)
+
+	for i := 0; i < 2; i++ {
+		sTime, err := client.BlockTime(123)
+		if err != nil {
+			t.Fatal(err)
+		}
+		if sTime != "2023-03-30T08:15:42Z" {
+			t.Errorf("BlockTime(123) = %s", sTime)
+		}
+	}
+	if blockCalls != 1 {
+		t.Errorf("/block queried %d times, want 1 (cached)", blockCalls)
+	}
+}
+
+func TestCallError(t *testing.T) {
+	var blockCalls int
+	node := newTestNode(t, "", &blockCalls)
+	defer node.Close()
+
+	client := NewClient(node.URL, 5*time.Second)
+	err := client.call("unknown", nil, &struct{}{})
+	if err == nil || IsNotFound(err) {
+		t.Errorf("unknown method: err = %v, want an error other than not found", err)
+	}
+
+	//an account that never received anything
+	pubKey, err := client.AccountPubKey(testAddr)
+	if pubKey != "" || !IsNotFound(err) {
+		t.Errorf("AccountPubKey() = %q, %v; want a not found error", pubKey, err)
+	}
+}
+
+func TestDecodeTxTruncated(t *testing.T) {
+	txB64, _ := testTxRaw()
+	raw, _ := base64.StdEncoding.DecodeString(txB64)
+
+	_, err := DecodeTx(base64.StdEncoding.EncodeToString(raw[:len(raw)-10]))
+	if err == nil {
+		t.Error("want an error for a truncated tx")
+	}
+}
@@ -1,7 +1,9 @@
 package taxcsv
 
 import (
+	"alexp/stakingtax/pkg/coins"
 	"alexp/stakingtax/pkg/utils"
+	"encoding/csv"
 	"fmt"
 	_ "log"
 	"os"
@@ -9,22 +11,40 @@ import (
 	"strings"
 
 	"github.com/gocarina/gocsv"
+	"golang.org/x/exp/slices"
 )
 
+// row categories
+const (
+	CategoryStaking       = "staking"        //tax relevant message (config's taxRelevantMessageTypes)
+	CategoryIncome        = "income"         //coins received in a tx signed by others (e.g. airdrops, payouts, sends from other wallets)
+	CategoryAutoCompound  = "auto_compound"  //authz MsgExec withdrawing our rewards and delegating them again (e.g. restake)
+	CategoryCommission    = "commission"     //validator commission (withdraw_commission)
+	CategoryOtherReceived = "other_received" //coins received in a tax relevant message apart from the rewards/commission paid out
+	CategoryFailed        = "failed"         //failed tx (non-zero code): only the fee we paid
+	CategoryFee           = "fee"            //only the fee we paid for a tx without tax relevant messages (network option feeRowsAllTxs)
+)
+
+//amounts are exact decimals (see coins.Dec), fiat values are rounded according to the config's fiatDecimals
 type TaxCsv struct {
-	Timestamp          string  `csv:"timestamp"`
-	Blockheight        int     `csv:"blockheight"`
-	MsgType            string  `csv:"msg_type"`
-	ReceivedAmount     float64 `csv:"received_amount"`
-	ReceivedCurrency   string  `csv:"received_currency"`
-	FeeAmount          float64 `csv:"fee_amount"`
-	FeeCurrency        string  `csv:"fee_currency"`
-	ReceivedFiatAmount float64 `csv:"received_fiat"`
-	FeeFiatAmount      float64 `csv:"fee_fiat"`
-	CoinPrice          float64 `csv:"coin_price_that_day"`
-	TxId               string  `csv:"tx_id"`
-	Addr               string  `csv:"address"`
-	Key                string  `csv:"pub_key"`
+	Timestamp          string    `csv:"timestamp"`
+	Blockheight        int       `csv:"blockheight"`
+	MsgType            string    `csv:"msg_type"`
+	ReceivedAmount     coins.Dec `csv:"received_amount"`
+	ReceivedCurrency   string    `csv:"received_currency"`
+	FeeAmount          coins.Dec `csv:"fee_amount"`
+	FeeCurrency        string    `csv:"fee_currency"`
+	ReceivedFiatAmount coins.Dec `csv:"received_fiat"`
+	FeeFiatAmount      coins.Dec `csv:"fee_fiat"`
+	CoinPrice          coins.Dec `csv:"coin_price_that_day"`
+	TxId               string    `csv:"tx_id"`
+	Addr               string    `csv:"address"`
+	Key                string    `csv:"pub_key"`
+	Category           string    `csv:"category"`
+	ExecMsgTypes       string    `csv:"exec_msg_types"` //authz MsgExec: our inner messages (; separated)
+	Grantee            string    `csv:"grantee"`        //authz MsgExec: the address which executed the messages (e.g. the restake bot)
+	Validator          string    `csv:"validator"`      //rewards/commission: the validator which paid them out
+	MsgIndex           int       `csv:"msg_index"`      //index of the message within the tx (fee-only rows: 0)
 }
 
 func GetLastBlockHeight(pathFile string) int {
@@ -80,6 +100,84 @@ func AppendNewTaxRows(pathFile string, allNewTaxCsvRows []*TaxCsv) {
 	}
 }
 
+// inserts the rows (in height order, e.g. backfilled ones) into the csv before the first row of a higher height, keeping the
+// file's rows as they are (each append starts with a header line). A merged block within a section of an other (older) header
+// gets its own header line, and the section's header is repeated after it for the section's remaining rows.
+func MergeTaxRows(pathFile string, newTaxCsvRows []*TaxCsv) {
+	var merged [][]string
+
+	if len(newTaxCsvRows) == 0 {
+		return
+	}
+	if !utils.CheckFileExists(pathFile) {
+		AppendNewTaxRows(pathFile, newTaxCsvRows)
+		return
+	}
+
+	f, err := os.Open(pathFile)
+	utils.ErrDefaultFatal(err)
+	reader := csv.NewReader(f)
+	reader.FieldsPerRecord = -1 //sections of older versions have fewer columns
+	records, err := reader.ReadAll()
+	f.Close()
+	utils.ErrDefaultFatal(err)
+
+	newLines, err := gocsv.MarshalString(&newTaxCsvRows)
+	utils.ErrDefaultFatal(err)
+	newRecords, err := csv.NewReader(strings.NewReader(newLines)).ReadAll()
+	utils.ErrDefaultFatal(err)
+	header, newRows := newRecords[0], newRecords[1:]
+
+	var sectionHeader []string
+	iNew := 0
+	for _, record := range records {
+		if isHeader(record) {
+			sectionHeader = record
+			merged = append(merged, record)
+			continue
+		}
+		iFrom := iNew
+		if len(record) > 1 {
+			if blockHeight, err := strconv.Atoi(record[1]); err == nil {
+				for iNew < len(newRows) && newTaxCsvRows[iNew].Blockheight < blockHeight {
+					iNew++
+				}
+			}
+		}
+		if iNew > iFrom && slices.Equal(sectionHeader, header) {
+			merged = append(merged, newRows[iFrom:iNew]...)
+		} else if iNew > iFrom {
+			merged = append(merged, header)
+			merged = append(merged, newRows[iFrom:iNew]...)
+			if sectionHeader != nil {
+				merged = append(merged, sectionHeader)
+			}
+		}
+		merged = append(merged, record)
+	}
+	if iNew < len(newRows) {
+		if !slices.Equal(sectionHeader, header) {
+			merged = append(merged, header)
+		}
+		merged = append(merged, newRows[iNew:]...)
+	}
+
+	//write to a temp file first, to not lose the csv if writing fails
+	f, err = os.OpenFile(pathFile+".tmp", os.O_WRONLY|os.O_CREATE|os.O_TRUNC, 0600)
+	utils.ErrDefaultFatal(err)
+	writer := csv.NewWriter(f)
+	err = writer.WriteAll(merged)
+	f.Close()
+	utils.ErrDefaultFatal(err)
+	err = os.Rename(pathFile+".tmp", pathFile)
+	utils.ErrDefaultFatal(err)
+}
+
+// header line of a section (written before each append)
+func isHeader(record []string) bool {
+	return record[0] == "timestamp"
+}
+
 // // If the file doesn't exist, create it, or append to the file
 // f, err := os.OpenFile("access.log", os.O_APPEND|os.O_CREATE|os.O_WRONLY, 0644)
 // if err != nil {
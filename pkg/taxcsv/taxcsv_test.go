@@ -0,0 +1,103 @@
+package taxcsv
+
+import (
+	"encoding/csv"
+	"os"
+	"path/filepath"
+	"strconv"
+	"strings"
+	"testing"
+
+	"github.com/gocarina/gocsv"
+)
+
+// the header before the columns of the categories, authz and validator details were added
+const oldHeader = "timestamp,blockheight,msg_type,received_amount,received_currency,fee_amount,fee_currency,received_fiat,fee_fiat,coin_price_that_day,tx_id,address,pub_key\n"
+
+// a row of the old header's columns, with a quoted field
+func oldRow(height int) string {
+	return "2023-01-01T00:00:00Z," + strconv.Itoa(height) + ",withdraw_delegator_reward,1.5,uatom,0.01,uatom,15,0.1,10,TX,cosmos1abc,\"key,with,commas\"\n"
+}
+
+func taxRows(heights ...int) []*TaxCsv {
+	var rows []*TaxCsv
+	for _, height := range heights {
+		rows = append(rows, &TaxCsv{Timestamp: "2023-01-02T00:00:00Z", Blockheight: height, MsgType: "delegate", Category: CategoryStaking})
+	}
+	return rows
+}
+
+// a section as appended by AppendNewTaxRows
+func newSection(t *testing.T, heights ...int) string {
+	rows := taxRows(heights...)
+	section, err := gocsv.MarshalString(&rows)
+	if err != nil {
+		t.Fatal(err)
+	}
+	return section
+}
+
+func TestMergeTaxRows(t *testing.T) {
+	tests := []struct {
+		name    string
+		content string
+		heights []int
+		want    []string //per record: "old"/"new" header or the height
+	}{
+		{"into an old section", oldHeader + oldRow(10) + oldRow(30), []int{20, 25},
+			[]string{"old", "10", "new", "20", "25", "old", "30"}},
+		{"after an old section", oldHeader + oldRow(10), []int{20},
+			[]string{"old", "10", "new", "20"}},
+		{"at the start of a current section", oldHeader + oldRow(10) + newSection(t, 30), []int{20},
+			[]string{"old", "10", "new", "20", "30"}},
+		{"into a current section", oldHeader + oldRow(10) + newSection(t, 20, 40), []int{15, 30, 50},
+			[]string{"old", "10", "new", "15", "20", "30", "40", "50"}},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			pathFile := filepath.Join(t.TempDir(), "tax.csv")
+			err := os.WriteFile(pathFile, []byte(tt.content), 0600)
+			if err != nil {
+				t.Fatal(err)
+			}
+
+			MergeTaxRows(pathFile, taxRows(tt.heights...))
+
+			data, err := os.ReadFile(pathFile)
+			if err != nil {
+				t.Fatal(err)
+			}
+			reader := csv.NewReader(strings.NewReader(string(data)))
+			reader.FieldsPerRecord = -1
+			records, err := reader.ReadAll()
+			if err != nil {
+				t.Fatal(err)
+			}
+
+			var got []string
+			var header []string
+			for i, record := range records {
+				switch {
+				case isHeader(record) && len(record) == 13:
+					got = append(got, "old")
+				case isHeader(record):
+					got = append(got, "new")
+				default:
+					got = append(got, record[1])
+				}
+				if isHeader(record) {
+					header = record
+				} else if len(record) != len(header) {
+					t.Errorf("record %d: %d columns under a header of %d", i, len(record), len(header))
+				}
+				if len(record) == 13 && !isHeader(record) && record[12] != "key,with,commas" {
+					t.Errorf("record %d: quoted field changed to %q", i, record[12])
+				}
+			}
+			if strings.Join(got, " ") != strings.Join(tt.want, " ") {
+				t.Errorf("records %v, want %v:\n%s", got, tt.want, data)
+			}
+		})
+	}
+}
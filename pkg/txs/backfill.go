@@ -0,0 +1,264 @@
+// backfill.go
+package txs
+
+import (
+	"alexp/stakingtax/pkg/configData"
+	nw "alexp/stakingtax/pkg/network"
+	"alexp/stakingtax/pkg/utils"
+	"fmt"
+	"log"
+	"os"
+	"strconv"
+	"strings"
+)
+
+// heights from-to (both included)
+type heightRange struct {
+	from int
+	to   int
+}
+
+func (r heightRange) String() string {
+	return strconv.Itoa(r.from) + "-" + strconv.Itoa(r.to)
+}
+
+// the gaps (height ranges pruned on the nodes before we fetched them) still missing in the csv, one from-to per line
+func gapsFile(chainName string, ourAddr string) string {
+	return chainName + "_" + ourAddr + "_gaps.txt"
+}
+
+func loadGaps(pathFile string) []heightRange {
+	var gaps []heightRange
+
+	if !utils.CheckFileExists(pathFile) {
+		return gaps
+	}
+	data, err := os.ReadFile(pathFile)
+	utils.ErrDefaultFatal(err)
+
+	for _, line := range strings.Fields(string(data)) {
+		var gap heightRange
+		_, err = fmt.Sscanf(line, "%d-%d", &gap.from, &gap.to)
+		utils.ErrDefaultFatal(err)
+		gaps = addGap(gaps, gap)
+	}
+	return gaps
+}
+
+// stores the gaps still missing; no file if there are none
+func saveGaps(pathFile string, gaps []heightRange) {
+	if len(gaps) == 0 {
+		if utils.CheckFileExists(pathFile) {
+			utils.ErrDefaultFatal(os.Remove(pathFile))
+		}
+		return
+	}
+
+	var lines []string
+	for _, gap := range gaps {
+		lines = append(lines, gap.String())
+	}
+	err := os.WriteFile(pathFile, []byte(strings.Join(lines, "\n")+"\n"), 0600)
+	utils.ErrDefaultFatal(err)
+}
+
+// adds the gap, joining it with the ones it overlaps or adjoins; the gaps are kept in height order. An empty range
+// (from > to) is no gap
+func addGap(gaps []heightRange, gap heightRange) []heightRange {
+	var result []heightRange
+
+	if gap.from > gap.to {
+		return gaps
+	}
+
+	for _, g := range gaps {
+		if g.to+1 < gap.from || gap.to+1 < g.from {
+			result = append(result, g)
+			continue
+		}
+		gap = heightRange{from: utils.MinInt(g.from, gap.from), to: utils.MaxInt(g.to, gap.to)}
+	}
+
+	for i, g := range result {
+		if gap.to < g.from {
+			return append(result[:i], append([]heightRange{gap}, result[i:]...)...)
+		}
+	}
+	return append(result, gap)
+}
+
+// removes the heights of r from the gaps
+func subtractRange(gaps []heightRange, r heightRange) []heightRange {
+	var result []heightRange
+
+	for _, g := range gaps {
+		if g.to < r.from || r.to < g.from {
+			result = append(result, g)
+			continue
+		}
+		if g.from < r.from {
+			result = append(result, heightRange{from: g.from, to: r.from - 1})
+		}
+		if r.to < g.to {
+			result = append(result, heightRange{from: r.to + 1, to: g.to})
+		}
+	}
+	return result
+}
+
+// the part of the gap the archive node has; ok=false if none
+func archiveCovers(archiveNode configData.ArchiveNodeType, gap heightRange) (heightRange, bool) {
+	r := gap
+	if archiveNode.FromHeight > r.from {
+		r.from = archiveNode.FromHeight
+	}
+	if archiveNode.ToHeight > 0 && archiveNode.ToHeight < r.to {
+		r.to = archiveNode.ToHeight
+	}
+	return r, r.from <= r.to
+}
+
+// fetches the gaps' txs of the streams from the network's archive nodes and merges their rows into the csv (height order);
+// returns the gaps no archive node could fill
+func backfillGaps(job *syncJob, cfg *configData.Cfg, streams []txStream, ourPubKey string, gaps []heightRange) []heightRange {
+	archiveNodes := cfg.Networks[job.networkIdx].ArchiveNodes
+	sLogSep := job.sLogSep
+	csvFile := job.chainI.ChainName + "_" + job.ourAddr + ".csv"
+
+	if len(gaps) == 0 {
+		return gaps
+	}
+	log.Println(sLogSep + "   Backfilling gaps from the archive nodes")
+
+	//an archive node only fetches what the ones before could not
+	for iArchive, archiveNode := range archiveNodes {
+		for _, gap := range gaps {
+			r, ok := archiveCovers(archiveNode, gap)
+			if !ok {
+				continue
+			}
+
+			//archive nodes are shared by all workers, like the nodes we sync from
+			src := limitNodeLoad(NewTxSourceForNode(job.chainI, archiveNode.Node), archiveNode.Node, cfg.Query.NodeLimit)
+			log.Println(sLogSep + "      [I] fetching heights " + r.String() + " from " + archiveNode.Node)
+
+			gapTxs := []TxResp{}
+			var err error
+			for k := range streams {
+				var streamTxs []TxResp
+				streamTxs, err = fetchRange(src, job.chainI.Backend, streams[k].query, r, iArchive < len(archiveNodes)-1, cfg, sLogSep)
+				if err != nil {
+					break
+				}
+				gapTxs = mergeTxs(gapTxs, streamTxs, streams[k].tIncoming)
+			}
+			if err != nil {
+				log.Println(sLogSep + "      [W] could not fetch heights " + r.String() + " from " + archiveNode.Node + ": " + err.Error())
+				continue
+			}
+
+			log.Println(sLogSep + "      [I] " + strconv.Itoa(len(gapTxs)) + " txs in heights " + r.String())
+			writeTaxRows(job, cfg, gapTxs, r.from-1, ourPubKey, true) //true: merge into the csv in height order
+			gaps = subtractRange(gaps, r)
+		}
+	}
+
+	if len(gaps) > 0 {
+		for _, gap := range gaps {
+			log.Println(sLogSep + "      [WARN] heights " + gap.String() + " are still MISSING in " + csvFile + ": no archive node (archiveNodes in config.yaml) has them")
+		}
+		log.Println(sLogSep + "             -> kept in " + gapsFile(job.chainI.ChainName, job.ourAddr) + " to be backfilled in a later run")
+	} else {
+		log.Println(sLogSep + "      [OK] gaps backfilled")
+	}
+	return gaps
+} //backfillGaps
+
+// all txs of the query in the heights of r. Backends knowing height conditions are asked for these heights only,
+// the daemon's txs are filtered by height: it returns them in ascending order -> we start at the page of r's first tx and
+// stop after r. Errors are returned once the retries are exhausted (tryRetrying): a failing archive node must not stop
+// the sync. tNodesLeft: an other archive node can take over
+func fetchRange(src TxSource, backend string, query TxQuery, r heightRange, tNodesLeft bool, cfg *configData.Cfg, sLogSep string) ([]TxResp, error) {
+	var txsResp *TxsResp
+	txs := []TxResp{}
+	pageFirst := 1
+
+	tHeightConditions := backend != nw.BackendDaemon
+	if tHeightConditions {
+		query.MinHeight = r.from
+		query.MaxHeight = r.to
+	} else {
+		txCountFirst, err := firstTxCountAt(src, query, r.from, tNodesLeft, cfg, sLogSep)
+		if err != nil {
+			return nil, err
+		}
+		if txCountFirst == 0 {
+			return txs, nil
+		}
+		pageFirst = (txCountFirst-1)/cfg.Query.PageLimit + 1
+	}
+
+	for page := pageFirst; ; page++ {
+		err := tryRetrying(src, "page "+strconv.Itoa(page), tNodesLeft, cfg, sLogSep, func() (err error) {
+			txsResp, err = src.Page(query, page, cfg.Query.PageLimit)
+			return err
+		})
+		if err != nil {
+			return nil, err
+		}
+		decodeTxsEvents(txsResp)
+
+		tBeyond := false
+		for _, tx := range txsResp.Txs {
+			height := heightOf(&tx)
+			if height > r.to {
+				tBeyond = true
+				break
+			}
+			if height >= r.from {
+				txs = append(txs, tx)
+			}
+		}
+
+		if tBeyond || len(txsResp.Txs) == 0 || txsResp.PageNumber == txsResp.PageTotal {
+			break
+		}
+	}
+	return txs, nil
+} //fetchRange
+
+// the count of the query's first tx at or above height, by bisecting the txs' heights (ascending); 0 if there is none
+func firstTxCountAt(src TxSource, query TxQuery, height int, tNodesLeft bool, cfg *configData.Cfg, sLogSep string) (int, error) {
+	var totalCount int
+
+	err := tryRetrying(src, "totalCount", tNodesLeft, cfg, sLogSep, func() (err error) {
+		totalCount, err = src.TotalCount(query)
+		return err
+	})
+	if err != nil {
+		return 0, err
+	}
+
+	//the first tx at or above height is in lo..hi; hi = totalCount+1: none
+	lo, hi := 1, totalCount+1
+	for lo < hi {
+		mid := (lo + hi) / 2
+		var midHeight int
+		err = tryRetrying(src, "height of tx "+strconv.Itoa(mid), tNodesLeft, cfg, sLogSep, func() (err error) {
+			midHeight, err = src.HeightOfTx(query, mid)
+			return err
+		})
+		if err != nil {
+			return 0, err
+		}
+		if midHeight >= height {
+			hi = mid
+		} else {
+			lo = mid + 1
+		}
+	}
+	if lo > totalCount {
+		return 0, nil
+	}
+	return lo, nil
+}
@@ -0,0 +1,67 @@
+// lcdsource.go
+package txs
+
+import (
+	"alexp/stakingtax/pkg/lcd"
+	"encoding/json"
+	"math"
+	"strconv"
+)
+
+// lcd backend: uses the node's rest api
+type lcdSource struct {
+	client *lcd.Client
+}
+
+func (src *lcdSource) TotalCount(query TxQuery) (int, error) {
+	return totalCountFromPage(src, query)
+}
+
+func (src *lcdSource) HeightOfTx(query TxQuery, txCount int) (int, error) {
+	return heightFromPage(src, query, txCount)
+}
+
+func (src *lcdSource) EarliestHeight() (int, error) {
+	return src.client.EarliestHeight()
+}
+
+func (src *lcdSource) AccountPubKey(addr string) (string, error) {
+	account, err := src.client.Account(addr)
+	if lcd.IsNotFound(err) {
+		return "", nil
+	}
+	if err != nil {
+		return "", err
+	}
+	return pubKeyFromAccountJson(account)
+}
+
+// query one page of txs matching the query via the node's rest api (lcd); its tx_responses have the
+// format of the daemon's json output, we only need to fill the page header
+func (src *lcdSource) Page(query TxQuery, page int, limit int) (*TxsResp, error) {
+
+	eventResp, err := src.client.TxsEvent(query.Conditions(), page, limit)
+	if err != nil {
+		return nil, err
+	}
+
+	totalCount, err := strconv.Atoi(eventResp.Total)
+	if err != nil {
+		return nil, err
+	}
+
+	txsResp := &TxsResp{}
+	if len(eventResp.TxResponses) > 0 {
+		err = json.Unmarshal(eventResp.TxResponses, &txsResp.Txs)
+		if err != nil {
+			return nil, err
+		}
+	}
+
+	txsResp.TotalCount = eventResp.Total
+	txsResp.Count = strconv.Itoa(len(txsResp.Txs))
+	txsResp.PageNumber = strconv.Itoa(page)
+	txsResp.PageTotal = strconv.Itoa(int(math.Ceil(float64(totalCount) / float64(limit))))
+
+	return txsResp, nil
+}
@@ -0,0 +1,128 @@
+// replaysource.go
+package txs
+
+import (
+	"alexp/stakingtax/pkg/utils"
+	"encoding/json"
+	"math"
+	"os"
+	"path/filepath"
+	"strconv"
+)
+
+// replay backend: serves recorded txs from disk instead of querying a node, e.g. to test the processing offline.
+// Per address, dir holds <chainName>_<addr>.json with the txs in the daemon's json format, like written by
+// daemon query txs --events 'message.sender=addr' --limit 100 -out json > chainName_addr.json
+// Queries are answered like a node would do: only the recorded txs having an event matching the query are returned
+type replaySource struct {
+	dir       string
+	chainName string
+	txs       map[string][]TxResp //per address, loaded on first use
+}
+
+func NewReplaySource(dir string, chainName string) TxSource {
+	return &replaySource{dir: dir, chainName: chainName, txs: map[string][]TxResp{}}
+}
+
+func (src *replaySource) load(ourAddr string) ([]TxResp, error) {
+	if txs, ok := src.txs[ourAddr]; ok {
+		return txs, nil
+	}
+
+	data, err := os.ReadFile(filepath.Join(src.dir, src.chainName+"_"+ourAddr+".json"))
+	if err != nil {
+		return nil, err
+	}
+
+	txsResp := &TxsResp{}
+	err = json.Unmarshal(data, txsResp)
+	if err != nil {
+		return nil, err
+	}
+
+	//recordings from old nodes may have base64 encoded event attributes
+	decodeTxsEvents(txsResp)
+
+	src.txs[ourAddr] = txsResp.Txs
+	return txsResp.Txs, nil
+}
+
+// the recorded txs of the query's address, having an event matching the query
+func (src *replaySource) query(query TxQuery) ([]TxResp, error) {
+	txs, err := src.load(query.Value)
+	if err != nil {
+		return nil, err
+	}
+
+	var txsMatching []TxResp
+	for _, tx := range txs {
+		if txMatchesQuery(&tx, query) {
+			txsMatching = append(txsMatching, tx)
+		}
+	}
+	return txsMatching, nil
+}
+
+// recordings are never pruned
+func (src *replaySource) EarliestHeight() (int, error) {
+	return 1, nil
+}
+
+// no account data recorded -> the pubkey is taken from the first tx the address signed
+func (src *replaySource) AccountPubKey(addr string) (string, error) {
+	return "", nil
+}
+
+// does any event (type.attribute=value) of the tx match the query
+func txMatchesQuery(tx *TxResp, query TxQuery) bool {
+	if query.MinHeight > 0 && heightOf(tx) < query.MinHeight {
+		return false
+	}
+	if query.MaxHeight > 0 && heightOf(tx) > query.MaxHeight {
+		return false
+	}
+	events := tx.Events
+	for _, logEvents := range tx.Logs {
+		events = append(events, logEvents.Events...)
+	}
+
+	for _, event := range events {
+		for _, attr := range event.Attributes {
+			if event.Type+"."+attr.Key == query.Key && attr.Value == query.Value {
+				return true
+			}
+		}
+	}
+	return false
+}
+
+func (src *replaySource) TotalCount(query TxQuery) (int, error) {
+	txs, err := src.query(query)
+	if err != nil {
+		return 0, err
+	}
+	return len(txs), nil
+}
+
+func (src *replaySource) HeightOfTx(query TxQuery, txCount int) (int, error) {
+	return heightFromPage(src, query, txCount)
+}
+
+func (src *replaySource) Page(query TxQuery, page int, limit int) (*TxsResp, error) {
+	txs, err := src.query(query)
+	if err != nil {
+		return nil, err
+	}
+
+	iStart := utils.MinInt((page-1)*limit, len(txs))
+	iEnd := utils.MinInt(page*limit, len(txs))
+
+	txsResp := &TxsResp{}
+	txsResp.Txs = txs[iStart:iEnd]
+	txsResp.TotalCount = strconv.Itoa(len(txs))
+	txsResp.Count = strconv.Itoa(len(txsResp.Txs))
+	txsResp.PageNumber = strconv.Itoa(page)
+	txsResp.PageTotal = strconv.Itoa(int(math.Ceil(float64(len(txs)) / float64(limit))))
+
+	return txsResp, nil
+}
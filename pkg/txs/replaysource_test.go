@@ -0,0 +1,103 @@
+package txs
+
+import (
+	"alexp/stakingtax/pkg/config"
+	"alexp/stakingtax/pkg/configData"
+	"alexp/stakingtax/pkg/taxcsv"
+	"io"
+	"log"
+	"os"
+	"testing"
+)
+
+const replayDir = "../../testdata/replay"
+
+// the fixtures' signer
+const replayPubKey = "AjoFxQuwZr7GkdGz5ZqLaXpyUqH93RuHiY1kGw3XXs74"
+
+// the fields of a row we check
+type replayRow struct {
+	height    int
+	msgType   string
+	amount    string
+	currency  string
+	fee       string
+	category  string
+	validator string
+	msgIndex  int
+}
+
+// fetches the txs we sent and received from the recordings like a sync does and processes them
+func replayRows(t *testing.T, networkIdx int, ourAddr string) []*taxcsv.TaxCsv {
+	cfg := &configData.Cfg{}
+	config.GetConfigFromFile(replayDir+"/config.yaml", cfg)
+	src := NewReplaySource(replayDir, cfg.Networks[networkIdx].Name)
+
+	log.SetOutput(io.Discard)
+	defer log.SetOutput(os.Stderr)
+
+	txs := []TxResp{}
+	for _, stream := range []txStream{{query: SenderQuery(ourAddr)}, {query: RecipientQuery(ourAddr), tIncoming: true}} {
+		txsResp, err := src.Page(stream.query, 1, 100)
+		if err != nil {
+			t.Fatal(err)
+		}
+		txs = mergeTxs(txs, txsResp.Txs, stream.tIncoming)
+	}
+	return processRecTxs(&TxsResp{Txs: txs}, 0, ourAddr, replayPubKey, cfg, networkIdx, "")
+}
+
+func checkReplayRows(t *testing.T, rows []*taxcsv.TaxCsv, want []replayRow) {
+	if len(rows) != len(want) {
+		for _, row := range rows {
+			t.Logf("%+v", *row)
+		}
+		t.Fatalf("%d rows, want %d", len(rows), len(want))
+	}
+	for i, row := range rows {
+		got := replayRow{row.Blockheight, row.MsgType, row.ReceivedAmount.String(), row.ReceivedCurrency, row.FeeAmount.String(), row.Category, row.Validator, row.MsgIndex}
+		if got != want[i] {
+			t.Errorf("row %d:\n got %+v\nwant %+v", i, got, want[i])
+		}
+	}
+}
+
+// sdk <0.47 format: the events per message in the logs, tendermint 0.34 base64 encoded attributes
+func TestReplayLogs(t *testing.T) {
+	const validator = "cosmosvaloper1tee9srkndz72epc563yrha5p5r3ppsamdqq2s9"
+
+	rows := replayRows(t, 0, "cosmos1ycv7ag92g3v4gmd7fsf9jjsz527qwpr3cd8pqn")
+	checkReplayRows(t, rows, []replayRow{
+		{8000050, MsgTypeWithdrawReward, "0.812", "atom", "0.004", taxcsv.CategoryStaking, validator, 0},
+		{9000100, MsgTypeWithdrawReward, "1.523456", "atom", "0.005", taxcsv.CategoryStaking, validator, 0},
+		{9000150, "/cosmos.bank.v1beta1.MsgSend", "7", "atom", "0", taxcsv.CategoryIncome, "", 0},
+		{9000200, MsgTypeDelegate, "0.02", "atom", "0.003", taxcsv.CategoryStaking, validator, 0},
+		{9000300, MsgTypeExec, "0.015", "atom", "0", taxcsv.CategoryAutoCompound, validator, 0},
+	})
+
+	if rows[4].ExecMsgTypes != MsgTypeWithdrawReward+";"+MsgTypeDelegate || rows[4].Grantee != "cosmos1u8474gx74qwzqe45xy6ypgrjpdhg2ut7cfnf80" {
+		t.Errorf("exec row: exec_msg_types %s, grantee %s", rows[4].ExecMsgTypes, rows[4].Grantee)
+	}
+}
+
+// sdk 0.50 format: no logs, the tx level events assigned to the messages by msg_index
+func TestReplayEvents(t *testing.T) {
+	const validator = "osmovaloper1tee9srkndz72epc563yrha5p5r3ppsam6c0var"
+	const allBTC = "factory/osmo1z6r6qdknhgsc0zeracktgpcxf43j6sekq07nw8sxduc9lg0qjjlqfu25e3/alloyed/allBTC"
+
+	rows := replayRows(t, 1, "osmo1ycv7ag92g3v4gmd7fsf9jjsz527qwpr3sk53kp")
+	checkReplayRows(t, rows, []replayRow{
+		//two messages: one row each, with its own validator; the fee goes to the first
+		{14000100, MsgTypeWithdrawReward, "0.41", "osmo", "0.0025", taxcsv.CategoryStaking, validator, 0},
+		{14000100, MsgTypeWithdrawReward, "0.09", "osmo", "0", taxcsv.CategoryStaking, "osmovaloper1n46fx27mdusac74jr4hu2fs0ga8q65u96ung4p", 1},
+		{14000180, MsgTypeDelegate, "0", "osmo", "0.0031", taxcsv.CategoryStaking, "", 0},
+		{14000200, MsgTypeDelegate, "0", "osmo", "0.0027", taxcsv.CategoryFailed, "", 0},
+		{14000220, "/cosmos.gov.v1beta1.MsgVote", "0", "osmo", "0.0018", taxcsv.CategoryFee, "", 0},
+		//one payout in three denoms (the untracked one in base units), and coins received apart from it
+		{14000250, MsgTypeWithdrawReward, "0.12", "osmo", "0.0024", taxcsv.CategoryStaking, validator, 0},
+		{14000250, MsgTypeWithdrawReward, "0.000035", "atom", "0", taxcsv.CategoryStaking, validator, 0},
+		{14000250, MsgTypeWithdrawReward, "8", allBTC, "0", taxcsv.CategoryStaking, validator, 0},
+		{14000250, MsgTypeWithdrawReward, "0.000777", "osmo", "0", taxcsv.CategoryOtherReceived, "", 0},
+		{14000260, MsgTypeWithdrawReward, "0.06", "osmo", "0", taxcsv.CategoryStaking, validator, 0},
+	})
+}
@@ -0,0 +1,138 @@
+// rpcsource.go
+package txs
+
+import (
+	"alexp/stakingtax/pkg/rpc"
+	"encoding/json"
+	"math"
+	"strconv"
+)
+
+// rpc backend: uses the node's json-rpc
+type rpcSource struct {
+	client *rpc.Client
+}
+
+func (src *rpcSource) TotalCount(query TxQuery) (int, error) {
+	return totalCountFromPage(src, query)
+}
+
+func (src *rpcSource) HeightOfTx(query TxQuery, txCount int) (int, error) {
+	return heightFromPage(src, query, txCount)
+}
+
+func (src *rpcSource) EarliestHeight() (int, error) {
+	return src.client.EarliestHeight()
+}
+
+func (src *rpcSource) AccountPubKey(addr string) (string, error) {
+	pubKey, err := src.client.AccountPubKey(addr)
+	if rpc.IsNotFound(err) {
+		return "", nil
+	}
+	return pubKey, err
+}
+
+// query one page of txs matching the query via the node's /tx_search and convert the
+// result to the daemon's json format, such that the rest of the processing does not care about the backend
+func (src *rpcSource) Page(query TxQuery, page int, limit int) (*TxsResp, error) {
+
+	searchResp, err := src.client.TxSearch(query.String(), page, limit)
+	if err != nil {
+		return nil, err
+	}
+
+	totalCount, err := strconv.Atoi(searchResp.TotalCount)
+	if err != nil {
+		return nil, err
+	}
+
+	txsResp := &TxsResp{}
+	txsResp.TotalCount = searchResp.TotalCount
+	txsResp.Count = strconv.Itoa(len(searchResp.Txs))
+	txsResp.PageNumber = strconv.Itoa(page)
+	txsResp.PageTotal = strconv.Itoa(int(math.Ceil(float64(totalCount) / float64(limit))))
+
+	for _, rTx := range searchResp.Txs {
+		txResp := TxResp{}
+		txResp.Height = rTx.Height
+		txResp.TxHash = rTx.Hash
+		txResp.Code = rTx.TxResult.Code
+		txResp.RawLog = rTx.TxResult.Log
+
+		//the tx itself does not carry a timestamp, the block does
+		height, err := strconv.Atoi(rTx.Height)
+		if err != nil {
+			return nil, err
+		}
+		txResp.Timestamp, err = src.client.BlockTime(height)
+		if err != nil {
+			return nil, err
+		}
+
+		//the log is the json the daemon shows as logs; it is no json for failed txs and empty since sdk 0.50 -> leave logs empty then
+		var logs []TxLog
+		if json.Unmarshal([]byte(rTx.TxResult.Log), &logs) == nil {
+			txResp.Logs = logs
+		}
+
+		//tx level events; since sdk 0.50 the messages' events are only given here (with msg_index)
+		for _, rEvent := range rTx.TxResult.Events {
+			event := TxEvent{Type: rEvent.Type}
+			for _, rAttr := range rEvent.Attributes {
+				event.Attributes = append(event.Attributes, TxEventAttribute{Key: rAttr.Key, Value: rAttr.Value})
+			}
+			txResp.Events = append(txResp.Events, event)
+		}
+
+		//fee and signers are only part of the protobuf encoded tx
+		dTx, err := rpc.DecodeTx(rTx.Tx)
+		if err != nil {
+			return nil, err
+		}
+		for _, pubKey := range dTx.SignerPubKeys {
+			signInfo := TxSignerInfo{}
+			signInfo.PublicKey.Key = pubKey
+			txResp.Tx.AuthInfo.SignerInfos = append(txResp.Tx.AuthInfo.SignerInfos, signInfo)
+		}
+		for _, coin := range dTx.FeeAmount {
+			txResp.Tx.AuthInfo.Fee.Amount = append(txResp.Tx.AuthInfo.Fee.Amount, TxCoin{Denom: coin.Denom, Amount: coin.Amount})
+		}
+		txResp.Tx.AuthInfo.Fee.Payer = dTx.FeePayer
+		txResp.Tx.AuthInfo.Fee.Granter = dTx.FeeGranter
+		for _, msg := range dTx.Messages {
+			txMsg, err := rpcTxMessage(msg)
+			if err != nil {
+				return nil, err
+			}
+			txResp.Tx.Body.Messages = append(txResp.Tx.Body.Messages, txMsg)
+		}
+
+		txsResp.Txs = append(txsResp.Txs, txResp)
+	}
+
+	return txsResp, nil
+}
+
+// converts a protobuf message to the fields of its json form we need (inner messages for authz MsgExec)
+func rpcTxMessage(msg rpc.Any) (TxMessage, error) {
+	txMsg := TxMessage{Type: msg.TypeUrl}
+	txMsg.DelegatorAddress, txMsg.ValidatorAddress = rpc.StakingAddresses(msg)
+	if msg.TypeUrl != MsgTypeExec {
+		return txMsg, nil
+	}
+
+	grantee, innerMsgs, err := rpc.DecodeMsgExec(msg.Value)
+	if err != nil {
+		return txMsg, err
+	}
+	txMsg.Grantee = grantee
+	for _, innerMsg := range innerMsgs {
+		innerTxMsg, err := rpcTxMessage(innerMsg)
+		if err != nil {
+			return txMsg, err
+		}
+		txMsg.Msgs = append(txMsg.Msgs, innerTxMsg)
+	}
+	return txMsg, nil
+}
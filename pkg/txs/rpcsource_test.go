@@ -0,0 +1,73 @@
+package txs
+
+import (
+	"alexp/stakingtax/pkg/rpc"
+	"encoding/base64"
+	"fmt"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+	"time"
+)
+
+// TxRaw of a MsgWithdrawDelegatorReward of cosmos1ycv7a...cd8pqn, fee 5000uatom granted by cosmos1a8kt5...f3vmxs
+const testTxRaw = "CqkBCqABCjcvY29zbW9zLmRpc3RyaWJ1dGlvbi52MWJldGExLk1zZ1dpdGhkcmF3RGVsZWdhdG9yUmV3YXJkEmUKLWNvc21vczF5Y3Y3YWc5MmczdjRnbWQ3ZnNmOWpqc3o1Mjdxd3ByM2NkOHBxbhI0Y29zbW9zdmFsb3BlcjFzamxsc25yYW10ZzNld3hxd3dyd2p4ZmdjNG40ZWY5dTJsY25qMBIEbWVtbxKWAQpQCkYKHy9jb3Ntb3MuY3J5cHRvLnNlY3AyNTZrMS5QdWJLZXkSIwohAqurq6urq6urq6urq6urq6urq6urq6urq6urq6urq6urEgQKAggBGCoSQgoNCgV1YXRvbRIENTAwMBDAmgwiLWNvc21vczFhOGt0NXRtamx4bTZ6bG04eXN0ZDhudDNnZ2tkOG05Z2Yzdm14cxpAAQEBAQEBAQEBAQEBAQEBAQEBAQEBAQEBAQEBAQEBAQEBAQEBAQEBAQEBAQEBAQEBAQEBAQEBAQEBAQEBAQEBAQ=="
+
+// the rpc source converts a /tx_search page of a tendermint 0.34 node (base64 event attributes) to the daemon's format
+func TestRpcSourcePage(t *testing.T) {
+	const ourAddr = "cosmos1ycv7ag92g3v4gmd7fsf9jjsz527qwpr3cd8pqn"
+	b64 := func(s string) string { return base64.StdEncoding.EncodeToString([]byte(s)) }
+
+	node := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		switch r.URL.Path {
+		case "/tx_search":
+			fmt.Fprintf(w, `{"jsonrpc":"2.0","id":-1,"result":{"txs":[{"hash":"ABCDEF","height":"123","index":0,
+				"tx_result":{"code":0,"log":"","events":[{"type":"coin_received","attributes":[
+				{"key":"%s","value":"%s"},{"key":"%s","value":"%s"},{"key":"%s","value":"%s"}]}]},
+				"tx":"%s"}],"total_count":"31"}}`, b64("receiver"), b64(ourAddr), b64("amount"), b64("12uatom"), b64("msg_index"), b64("0"), testTxRaw)
+		case "/block":
+			fmt.Fprint(w, `{"jsonrpc":"2.0","id":-1,"result":{"block":{"header":{"height":"123","time":"2023-03-30T08:15:42.987654321Z"}}}}`)
+		default:
+			w.WriteHeader(http.StatusNotFound)
+		}
+	}))
+	defer node.Close()
+
+	src := &rpcSource{client: rpc.NewClient(node.URL, 5*time.Second)}
+	txsResp, err := src.Page(TxQuery{Key: "message.sender", Value: ourAddr, MinHeight: 100}, 2, 30)
+	if err != nil {
+		t.Fatal(err)
+	}
+	decodeTxsEvents(txsResp)
+
+	if txsResp.TotalCount != "31" || txsResp.Count != "1" || txsResp.PageNumber != "2" || txsResp.PageTotal != "2" {
+		t.Errorf("page header = %s/%s, page %s/%s", txsResp.Count, txsResp.TotalCount, txsResp.PageNumber, txsResp.PageTotal)
+	}
+	tx := txsResp.Txs[0]
+	if tx.TxHash != "ABCDEF" || tx.Height != "123" || tx.Timestamp != "2023-03-30T08:15:42Z" || len(tx.Logs) != 0 {
+		t.Errorf("tx = %s at %s, %s, %d logs", tx.TxHash, tx.Height, tx.Timestamp, len(tx.Logs))
+	}
+
+	if got := txEventAttr(tx.Events, "coin_received", "receiver"); got != ourAddr {
+		t.Errorf("receiver = %q, want the decoded address", got)
+	}
+	if got := txEventAttr(tx.Events, "coin_received", "amount"); got != "12uatom" {
+		t.Errorf("amount = %q, want 12uatom", got)
+	}
+	if msgLogs := txMessageLogs(&tx, ""); len(msgLogs) != 1 || len(msgLogs[0].Events) != 1 {
+		t.Errorf("events of msg_index 0: %+v", msgLogs)
+	}
+
+	msgs := tx.Tx.Body.Messages
+	if len(msgs) != 1 || msgs[0].Type != MsgTypeWithdrawReward || msgs[0].DelegatorAddress != ourAddr ||
+		msgs[0].ValidatorAddress != "cosmosvaloper1sjllsnramtg3ewxqwwrwjxfgc4n4ef9u2lcnj0" {
+		t.Errorf("messages = %+v", msgs)
+	}
+	fee := tx.Tx.AuthInfo.Fee
+	if len(fee.Amount) != 1 || fee.Amount[0] != (TxCoin{Denom: "uatom", Amount: "5000"}) || fee.Granter != "cosmos1a8kt5tmjlxm6zlm8ystd8nt3ggkd8m9gf3vmxs" {
+		t.Errorf("fee = %+v", fee)
+	}
+	if signers := tx.Tx.AuthInfo.SignerInfos; len(signers) != 1 || signers[0].PublicKey.Key != "Aqurq6urq6urq6urq6urq6urq6urq6urq6urq6urq6ur" {
+		t.Errorf("signer infos = %+v", signers)
+	}
+}
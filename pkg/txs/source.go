@@ -0,0 +1,397 @@
+// source.go
+package txs
+
+import (
+	"alexp/stakingtax/pkg/lcd"
+	nw "alexp/stakingtax/pkg/network"
+	"alexp/stakingtax/pkg/rpc"
+	"alexp/stakingtax/pkg/utils"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"log"
+	"os/exec"
+	"regexp"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+)
+
+// event filter of a tx query, like message.sender=addr, optionally restricted to txs from MinHeight on (up to MaxHeight)
+type TxQuery struct {
+	Key       string
+	Value     string
+	MinHeight int //0: no restriction
+	MaxHeight int //0: no restriction
+}
+
+// the txs we sent (signed or occur as sender in a message)
+func SenderQuery(ourAddr string) TxQuery {
+	return TxQuery{Key: "message.sender", Value: ourAddr}
+}
+
+// the txs where we received coins, also those signed by others
+func RecipientQuery(ourAddr string) TxQuery {
+	return TxQuery{Key: "transfer.recipient", Value: ourAddr}
+}
+
+// the query's conditions in tendermint query syntax as used by rpc and lcd: key='value', tx.height>=minHeight, tx.height<=maxHeight
+func (q TxQuery) Conditions() []string {
+	conditions := []string{q.Key + "='" + q.Value + "'"}
+	if q.MinHeight > 0 {
+		//>= instead of > as old sdk versions only accept conditions containing a '='
+		conditions = append(conditions, "tx.height>="+strconv.Itoa(q.MinHeight))
+	}
+	if q.MaxHeight > 0 {
+		conditions = append(conditions, "tx.height<="+strconv.Itoa(q.MaxHeight))
+	}
+	return conditions
+}
+
+func (q TxQuery) String() string {
+	return strings.Join(q.Conditions(), " AND ")
+}
+
+// TxSource fetches the txs matching a query, in ascending order; one implementation per backend
+// (daemon, rpc, lcd) plus replay, which serves recorded query results from disk (e.g. for tests)
+type TxSource interface {
+	// total number of txs matching the query
+	TotalCount(query TxQuery) (int, error)
+	// one page (starting at 1) of txs, in the daemon's json format
+	Page(query TxQuery, page int, limit int) (*TxsResp, error)
+	// blockheight of the txCount'th tx (starting at 1)
+	HeightOfTx(query TxQuery, txCount int) (int, error)
+	// earliest blockheight the node still has (pruned nodes return >1)
+	EarliestHeight() (int, error)
+	// pubkey (base64) of the account as stored by the auth module; "" if unknown (never signed a tx or not supported)
+	AccountPubKey(addr string) (string, error)
+}
+
+// returns the network's tx source as set up by nw.CheckNetworks
+func NewTxSource(chainI *nw.ChainInfo) TxSource {
+	switch chainI.Backend {
+	case nw.BackendRpc:
+		return &rpcSource{client: chainI.RpcClient}
+	case nw.BackendLcd:
+		return &lcdSource{client: chainI.LcdClient}
+	case nw.BackendReplay:
+		return NewReplaySource(chainI.ReplayDir, chainI.ChainName)
+	default:
+		return &daemonSource{daemonName: chainI.DaemonName}
+	}
+}
+
+// returns a tx source for the network's backend, querying the given node instead of the default one
+func NewTxSourceForNode(chainI *nw.ChainInfo, node string) TxSource {
+	switch chainI.Backend {
+	case nw.BackendRpc:
+		return &rpcSource{client: rpc.NewClient(node, 60*time.Second)}
+	case nw.BackendLcd:
+		return &lcdSource{client: lcd.NewClient(node, 60*time.Second)}
+	case nw.BackendReplay:
+		if node != "" {
+			return NewReplaySource(node, chainI.ChainName) //the node is a directory with recordings
+		}
+		return NewReplaySource(chainI.ReplayDir, chainI.ChainName)
+	default:
+		return &daemonSource{daemonName: chainI.DaemonName, node: node}
+	}
+}
+
+// max concurrent queries to one node, if not configured
+const defaultNodeLimit = 2
+
+// per node: one slot per query running concurrently on it
+var nodeSlots = struct {
+	sync.Mutex
+	m map[string]chan struct{}
+}{m: map[string]chan struct{}{}}
+
+// tx source taking a slot of its node for each query, such that the workers do not hammer a (public) node
+type nodeLimitedSource struct {
+	src   TxSource
+	slots chan struct{}
+}
+
+// wraps the source to run at most limit queries at a time on the node (over all workers)
+func limitNodeLoad(src TxSource, node string, limit int) TxSource {
+	if limit <= 0 {
+		limit = defaultNodeLimit
+	}
+
+	nodeSlots.Lock()
+	defer nodeSlots.Unlock()
+	if nodeSlots.m[node] == nil {
+		nodeSlots.m[node] = make(chan struct{}, limit)
+	}
+	return &nodeLimitedSource{src: src, slots: nodeSlots.m[node]}
+}
+
+func (src *nodeLimitedSource) acquire() {
+	src.slots <- struct{}{}
+}
+
+func (src *nodeLimitedSource) release() {
+	<-src.slots
+}
+
+func (src *nodeLimitedSource) TotalCount(query TxQuery) (int, error) {
+	src.acquire()
+	defer src.release()
+	return src.src.TotalCount(query)
+}
+
+func (src *nodeLimitedSource) Page(query TxQuery, page int, limit int) (*TxsResp, error) {
+	src.acquire()
+	defer src.release()
+	return src.src.Page(query, page, limit)
+}
+
+func (src *nodeLimitedSource) HeightOfTx(query TxQuery, txCount int) (int, error) {
+	src.acquire()
+	defer src.release()
+	return src.src.HeightOfTx(query, txCount)
+}
+
+func (src *nodeLimitedSource) EarliestHeight() (int, error) {
+	src.acquire()
+	defer src.release()
+	return src.src.EarliestHeight()
+}
+
+func (src *nodeLimitedSource) AccountPubKey(addr string) (string, error) {
+	src.acquire()
+	defer src.release()
+	return src.src.AccountPubKey(addr)
+}
+
+// failed tries of a page on one node before failing over, if not configured
+const defaultFailoverAfter = 3
+
+// tx source of a sync job, which can fail over along the network's node pool (nw.ChainInfo.NodePool)
+type failoverSource struct {
+	TxSource   //the current node's source
+	chainI     *nw.ChainInfo
+	nodeLimit  int
+	poolIdx    int
+	lastHeight int //all txs up to it are fetched: a node to fail over to has to have the blocks after it
+}
+
+func newFailoverSource(chainI *nw.ChainInfo, nodeLimit int) *failoverSource {
+	src := &failoverSource{chainI: chainI, nodeLimit: nodeLimit}
+	if len(chainI.NodePool) == 0 {
+		src.TxSource = NewTxSource(chainI) //replay: no node
+		return src
+	}
+	src.useNode(0)
+	return src
+}
+
+func (src *failoverSource) useNode(poolIdx int) {
+	src.poolIdx = poolIdx
+	if poolIdx == 0 {
+		//the node checked at start, its client is shared by the network's jobs
+		src.TxSource = limitNodeLoad(NewTxSource(src.chainI), src.Node(), src.nodeLimit)
+	} else {
+		src.TxSource = limitNodeLoad(NewTxSourceForNode(src.chainI, src.chainI.NodePool[poolIdx]), src.Node(), src.nodeLimit)
+	}
+}
+
+// the node queried; "" for replay
+func (src *failoverSource) Node() string {
+	if len(src.chainI.NodePool) == 0 {
+		return ""
+	}
+	if node := src.chainI.NodePool[src.poolIdx]; node != "" {
+		return node
+	}
+	return src.chainI.DaemonName + "'s config node"
+}
+
+// the txs up to height are fetched; only nodes having the blocks after it are failed over to
+func (src *failoverSource) synced(height int) {
+	src.lastHeight = utils.MaxInt(src.lastHeight, height)
+}
+
+// switches to the next node of the pool that is usable (synced, indexing txs) and covers the heights still to be fetched;
+// false if there is none left
+func (src *failoverSource) failover(sLogSep string) bool {
+	for i := src.poolIdx + 1; i < len(src.chainI.NodePool); i++ {
+		node := src.chainI.NodePool[i]
+		probe := src.chainI.ProbeNode(node, false) //nodes in the pool already have their port
+		if !probe.Covers(src.lastHeight) {
+			log.Println(sLogSep + "      [I] node " + node + " is " + probe.Shortcoming(src.lastHeight) + ", skipping it")
+			continue
+		}
+		src.useNode(i)
+		return true
+	}
+	return false
+}
+
+// the header of a page holds the total count -> get only 1 tx
+func totalCountFromPage(src TxSource, query TxQuery) (int, error) {
+	txsRespThin, err := src.Page(query, 1, 1)
+	if err != nil {
+		return 0, err
+	}
+	return strconv.Atoi(txsRespThin.TotalCount)
+}
+
+// with a page size of 1, the page number is the tx count
+func heightFromPage(src TxSource, query TxQuery, txCount int) (int, error) {
+	txsRespThin, err := src.Page(query, txCount, 1)
+	if err != nil {
+		return 0, err
+	}
+	if len(txsRespThin.Txs) == 0 {
+		return 0, errors.New("no tx returned for txCount " + strconv.Itoa(txCount))
+	}
+	return strconv.Atoi(txsRespThin.Txs[0].Height)
+}
+
+// the daemon prints the grpc status of a failed query, like: rpc error: code = NotFound desc = account ... not found
+var reGrpcNotFound = regexp.MustCompile(`code = NotFound\b`)
+
+// accounts unknown to the chain (never received anything) are answered with grpc NotFound; the daemon only gives its output
+func daemonNotFound(out []byte) bool {
+	return reGrpcNotFound.Match(out)
+}
+
+// the pubkey in an account's json as given by the daemon's 'query account' or the lcd: BaseAccount has pub_key{key},
+// other account types embed it (base_vesting_account.base_account, base_account); amino json (sdk 0.50 daemons)
+// wraps the account in value and has pub_key{value}
+func pubKeyFromAccountJson(data []byte) (string, error) {
+	var account map[string]interface{}
+
+	err := json.Unmarshal(data, &account)
+	if err != nil {
+		return "", err
+	}
+	return findPubKey(account, 0), nil
+}
+
+func findPubKey(account map[string]interface{}, depth int) string {
+	if pubKey, ok := account["pub_key"].(map[string]interface{}); ok {
+		for _, key := range []string{"key", "value"} {
+			if sKey, ok := pubKey[key].(string); ok && sKey != "" {
+				return sKey
+			}
+		}
+	}
+
+	if depth >= 4 {
+		return ""
+	}
+	for _, embedded := range []string{"account", "value", "base_vesting_account", "base_account"} {
+		if sub, ok := account[embedded].(map[string]interface{}); ok {
+			if sKey := findPubKey(sub, depth+1); sKey != "" {
+				return sKey
+			}
+		}
+	}
+	return ""
+}
+
+//------------------------------------------------------------------------------
+// daemon backend: uses the chain's command line daemon
+
+type daemonSource struct {
+	daemonName string
+	node       string //optional, empty: daemon's config node
+}
+
+func (src *daemonSource) TotalCount(query TxQuery) (int, error) {
+	return totalCountFromPage(src, query)
+}
+
+func (src *daemonSource) HeightOfTx(query TxQuery, txCount int) (int, error) {
+	return heightFromPage(src, query, txCount)
+}
+
+// daemon status json; older versions use upper case keys
+type daemonStatus struct {
+	SyncInfo struct {
+		EarliestBlockHeight string `json:"earliest_block_height"`
+	} `json:"SyncInfo"`
+	SyncInfoNew struct {
+		EarliestBlockHeight string `json:"earliest_block_height"`
+	} `json:"sync_info"`
+}
+
+func (src *daemonSource) EarliestHeight() (int, error) {
+	var args []string
+
+	if src.node != "" {
+		args = append(args, "--node", src.node)
+	}
+	args = append(args, "status")
+
+	out, err := exec.Command(src.daemonName, args...).CombinedOutput()
+	if err != nil {
+		s := string(out)
+		err = fmt.Errorf("%w; %v", err, s)
+		return 0, err
+	}
+
+	status := &daemonStatus{}
+	err = json.Unmarshal(out, status)
+	if err != nil {
+		return 0, err
+	}
+	if status.SyncInfo.EarliestBlockHeight != "" {
+		return strconv.Atoi(status.SyncInfo.EarliestBlockHeight)
+	}
+	return strconv.Atoi(status.SyncInfoNew.EarliestBlockHeight)
+}
+
+func (src *daemonSource) AccountPubKey(addr string) (string, error) {
+	var args []string
+
+	if src.node != "" {
+		args = append(args, "--node", src.node)
+	}
+	args = append(args, "query", "account", addr, "-o", "json")
+
+	out, err := exec.Command(src.daemonName, args...).CombinedOutput()
+	if err != nil {
+		if daemonNotFound(out) {
+			return "", nil
+		}
+		s := string(out)
+		err = fmt.Errorf("%w; %v", err, s)
+		return "", err
+	}
+
+	return pubKeyFromAccountJson(out)
+}
+
+func (src *daemonSource) Page(query TxQuery, page int, limit int) (*TxsResp, error) {
+	var args []string
+
+	//the daemon's --events only knows key=value conditions
+	if query.MinHeight > 0 || query.MaxHeight > 0 {
+		return nil, errors.New("the daemon backend does not support height restricted queries")
+	}
+
+	if src.node != "" {
+		args = append(args, "--node", src.node)
+	}
+	args = append(args, "query", "txs", "--events", "'"+query.Key+"="+query.Value+"'", "--page", strconv.Itoa(page), "--limit", strconv.Itoa(limit), "-out", "json")
+
+	txsResp := &TxsResp{}
+	out, err := exec.Command(src.daemonName, args...).CombinedOutput()
+	if err != nil {
+		s := string(out)
+		err = fmt.Errorf("%w; %v", err, s)
+		return nil, err
+	}
+
+	err = json.Unmarshal(out, &txsResp)
+	if err != nil {
+		return nil, err
+	}
+
+	return txsResp, nil
+}
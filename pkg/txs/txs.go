@@ -1,79 +1,114 @@
 package txs
 
 import (
+	"alexp/stakingtax/pkg/address"
+	"alexp/stakingtax/pkg/coins"
 	"alexp/stakingtax/pkg/configData"
 	"alexp/stakingtax/pkg/exch"
 	nw "alexp/stakingtax/pkg/network"
 	"alexp/stakingtax/pkg/taxcsv"
 	"alexp/stakingtax/pkg/utils"
+	"encoding/base64"
+	"regexp"
 	"time"
-	"unicode"
 
-	"encoding/json"
-	"fmt"
 	"log"
 	"math"
 	_ "os"
-	"os/exec"
+	"sort"
 	"strconv"
+	"strings"
+	"sync"
 
 	"golang.org/x/exp/slices"
 )
 
+type TxEventAttribute struct {
+	Key   string `json:"key"`
+	Value string `json:"value"`
+}
+
+type TxEvent struct {
+	Type       string             `json:"type"`
+	Attributes []TxEventAttribute `json:"attributes"`
+}
+
+type TxLog struct {
+	Events []TxEvent `json:"events"`
+}
+
+type TxCoin struct {
+	Denom  string `json:"denom"`
+	Amount string `json:"amount"`
+}
+
+// a message of the tx body, only the fields we need: for authz MsgExec the grantee and the inner messages,
+// for staking/distribution messages the delegator and validator
+type TxMessage struct {
+	Type             string      `json:"@type"`
+	Grantee          string      `json:"grantee"`
+	Msgs             []TxMessage `json:"msgs"`
+	DelegatorAddress string      `json:"delegator_address"`
+	ValidatorAddress string      `json:"validator_address"`
+}
+
+type TxSignerInfo struct {
+	PublicKey struct {
+		Key string `json:"key"`
+	} `json:"public_key"`
+}
+
+type TxResp struct {
+	Height    string    `json:"height"`
+	TxHash    string    `json:"txhash"`
+	Timestamp string    `json:"timestamp"`
+	Code      int       `json:"code"`    //0: success; failed txs have no logs and only the fee payment in their events
+	RawLog    string    `json:"raw_log"` //the error for failed txs
+	Logs      []TxLog   `json:"logs"`    //per message events (until sdk 0.47)
+	Events    []TxEvent `json:"events"`  //tx level events; since sdk 0.50 the only ones, assigned to messages via msg_index
+	TIncoming bool      `json:"-"`       //our extra parameter: tx only found via the incoming (recipient) stream
+	Tx        struct {
+		Body struct {
+			Messages []TxMessage `json:"messages"`
+		} `json:"body"`
+		AuthInfo struct {
+			SignerInfos []TxSignerInfo `json:"signer_infos"`
+			Fee         struct {
+				Amount  []TxCoin `json:"amount"`
+				Payer   string   `json:"payer"`   //pays the fee instead of the first signer (must sign as well)
+				Granter string   `json:"granter"` //pays the fee via feegrant
+			} `json:"fee"`
+		} `json:"auth_info"`
+	} `json:"tx"`
+}
+
+// txs query result in the format of the daemon's 'query txs' json output; the rpc backend converts to it
 type TxsResp struct {
-	TotalCount string `json:"total_count"`
-	Count      string `json:"count"`
-	PageNumber string `json:"page_number"`
-	PageTotal  string `json:"page_total"`
-	Txs        []struct {
-		Height    string `json:"height"`
-		TxHash    string `json:"txhash"`
-		Timestamp string `json:"timestamp"`
-		Logs      []struct {
-			Events []struct {
-				Type       string `json:"type"`
-				Attributes []struct {
-					Key   string `json:"key"`
-					Value string `json:"value"`
-				} `json:"attributes"`
-			} `json:"events"`
-		} `json:"logs"`
-		Tx struct {
-			AuthInfo struct {
-				SignerInfos []struct {
-					PublicKey struct {
-						Key string `json:"key"`
-					} `json:"public_key"`
-				} `json:"signer_infos"`
-				Fee struct {
-					Amount []struct {
-						Denom  string `json:"denom"`
-						Amount string `json:"amount"`
-					} `json:"amount"`
-				} `json:"fee"`
-			} `json:"auth_info"`
-		} `json:"tx"`
-	} `json:"txs"`
+	TotalCount string   `json:"total_count"`
+	Count      string   `json:"count"`
+	PageNumber string   `json:"page_number"`
+	PageTotal  string   `json:"page_total"`
+	Txs        []TxResp `json:"txs"`
 }
 
 func GetProcessTxsForNetworks(cfg *configData.Cfg, cfgAdr *configData.CfgAdr, chainInfos []nw.ChainInfo) {
-	pageLimit := cfg.Query.PageLimit
 	var networkIdx int
 	var addrs []string
 	var pubKeys []string
-	var blockHeightOld, blockHeight int
-	var txCountOld, txCountUsed, txRecieved int
-	var page int
-	var ourPubKey string
-	var pageTotal, totalCount int
-	var err error
-	var sLogSep string
-	//tradePairs4Tax := &configData.TradePairs4TaxType{}
-	var tradePairs4Tax *configData.TradePairs4TaxType
+	var tHeightSync bool
+	var jobs []syncJob
 
 	//get cfg's networks and relevant message types
 	networks := cfg.GetNetworksFieldString("Name")
 
+	//fee allocation over multi message txs
+	if !slices.Contains([]string{"", FeeAllocationFirst, FeeAllocationEven, FeeAllocationProportional}, cfg.FeeAllocation) {
+		log.Fatal("Unknown feeAllocation: " + cfg.FeeAllocation + " given in config (use first, even or proportional). " + utils.FatalDetails())
+	}
+
+	//one worker: addresses are synced one after the other, as they are found
+	tConcurrent := cfg.Query.Workers > 1
+
 	log.Println("Querying networks for txs =======================================================================")
 
 	for i, network := range cfgAdr.Addresses {
@@ -93,183 +128,632 @@ func GetProcessTxsForNetworks(cfg *configData.Cfg, cfgAdr *configData.CfgAdr, ch
 		addrs = cfgAdr.GetFieldString(i, "Addr")
 		pubKeys = cfgAdr.GetFieldString(i, "PubKey")
 
-		log.Println("Querying " + network.ChainName + "--------------------------------------------------------")
+		//sync mode: resume via tx count (default) or from the last height in the csv
+		tHeightSync = cfg.Query.SyncMode == SyncModeHeight
+		if tHeightSync && chainInfos[networkIdx].Backend == nw.BackendDaemon {
+			log.Println("[W] syncMode height is not supported by the daemon backend (no height conditions in --events) -> using syncMode count for " + network.ChainName)
+			tHeightSync = false
+		}
+
+		if !tConcurrent {
+			log.Println("Querying " + network.ChainName + "--------------------------------------------------------")
+		}
 		//we need to handle each address individually, as cosmos query does not provide || for event filter (only &&)
 		//-> we can only get the txs per address individually
 		for j, ourAddr := range addrs {
-			ourPubKey = pubKeys[j]
+			job := syncJob{networkIdx: networkIdx, chainI: &chainInfos[networkIdx], ourAddr: ourAddr, cfgPubKey: pubKeys[j], tHeightSync: tHeightSync}
+			if !tConcurrent {
+				syncAddress(&job, cfg)
+				continue
+			}
+			//the workers' log lines interleave -> prefix them with the address they belong to
+			job.sLogSep = "[" + network.ChainName + " " + shortAddr(ourAddr) + "] "
+			jobs = append(jobs, job)
+		} //for over networks addresses in cfgAdr
 
-			log.Println("   addr: " + ourAddr)
-			log.Println("   Checking totalCount hypothesis")
+	} // for over the networks
 
-			//=== get most current retrieved txs' blockheight (last line) from csv file and tx count
-			blockHeightOld = taxcsv.GetLastBlockHeight(network.ChainName + "_" + ourAddr + ".csv")
-			txCountOld = taxcsv.GetLastTxCount(network.ChainName + "_" + ourAddr + "_count.txt")
+	if tConcurrent {
+		runSyncJobs(jobs, cfg)
+	}
+
+	log.Println("[OK] Querying networks for txs ==================================================================")
 
-			//=== get only 1 tx to get header info about nr of total transactions
-			totalCount = queryTotalCount(chainInfos[networkIdx].DaemonName, ourAddr)
-			blockHeight = queryHeight(chainInfos[networkIdx].DaemonName, ourAddr, totalCount)
-			log.Println("      [I] txCountOld/totalCount: " + strconv.Itoa(txCountOld) + "/" + strconv.Itoa(totalCount))
+} //GetProcessTxsForNetworks
 
-			//=== hypothesis check
-			txCountUsed = txCountOld
-			if txCountOld != 0 {
-				txCountUsed = checkHypothesisUpdateTxCount(txCountOld, totalCount, blockHeight, blockHeightOld, chainInfos[networkIdx].DaemonName, ourAddr, cfg.Query.TxStepBack)
-				//it is ensured that txCountUsed<=totalcount and in case they match, that also blockHeights match!
+// one address of a network to sync, the unit of work of the workers
+type syncJob struct {
+	networkIdx  int
+	chainI      *nw.ChainInfo
+	ourAddr     string
+	cfgPubKey   string //as given in addr.yaml (optional)
+	tHeightSync bool
+	sLogSep     string //prefix of the job's log lines
+}
+
+// syncs the jobs with cfg.Query.Workers workers. A worker only blocks its own job (e.g. retrying a flaky node),
+// the load on each node is limited by cfg.Query.NodeLimit
+func runSyncJobs(jobs []syncJob, cfg *configData.Cfg) {
+	var wg sync.WaitGroup
+	jobCh := make(chan *syncJob)
+
+	log.Println("[I] syncing " + strconv.Itoa(len(jobs)) + " addresses with " + strconv.Itoa(cfg.Query.Workers) + " workers")
+	for w := 0; w < cfg.Query.Workers; w++ {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			for job := range jobCh {
+				syncAddress(job, cfg)
 			}
+		}()
+	}
+
+	for i := range jobs {
+		jobCh <- &jobs[i]
+	}
+	close(jobCh)
+	wg.Wait()
+}
+
+// cosmos1ycv7a...cd8pqn
+func shortAddr(addr string) string {
+	if len(addr) <= 20 {
+		return addr
+	}
+	return addr[:12] + "..." + addr[len(addr)-6:]
+}
 
-			//replace it to use the possibly updated value
-			txCountOld = txCountUsed
+// fetches the new txs of the address, processes them and appends the tax relevant rows to the address' csv
+func syncAddress(job *syncJob, cfg *configData.Cfg) {
+	var blockHeightOld int
+	var ourPubKey string
+	var streams []txStream
+	chainName := job.chainI.ChainName
+	ourAddr := job.ourAddr
+	sLogSep := job.sLogSep
+	csvFile := chainName + "_" + ourAddr + ".csv"
+
+	//backend as configured for this network, sharing the node with the other workers; fails over to the next node of the pool
+	txSource := newFailoverSource(job.chainI, cfg.Query.NodeLimit)
+
+	log.Println(sLogSep + "   addr: " + ourAddr)
+
+	//=== get most current retrieved txs' blockheight (last line) from csv file
+	blockHeightOld = taxcsv.GetLastBlockHeight(csvFile)
+	txSource.synced(blockHeightOld)
+
+	//=== the pubkey is optional in addr.yaml: discover it on chain, verify a given one
+	ourPubKey = resolvePubKey(txSource, ourAddr, job.cfgPubKey, cfg, sLogSep)
+
+	//=== the query streams: txs we sent and optionally txs others sent to us; each has its own tx count
+	streams = []txStream{{query: SenderQuery(ourAddr), countFile: chainName + "_" + ourAddr + "_count.txt"}}
+	if cfg.Networks[job.networkIdx].QueryIncoming || ourPubKey == "" {
+		//an address that never signed a tx only receives (e.g. rewards withdrawn by a restake bot)
+		streams = append(streams, txStream{query: RecipientQuery(ourAddr), countFile: chainName + "_" + ourAddr + "_in_count.txt", tIncoming: true})
+	}
 
-			log.Println("      [I] using txCount/totalCount: " + strconv.Itoa(txCountOld) + "/" + strconv.Itoa(totalCount))
+	//=== gaps not backfilled in former runs
+	gaps := loadGaps(gapsFile(chainName, ourAddr))
 
-			//=== new txs not yet retrieved?
-			if totalCount == txCountOld {
-				log.Println("   [OK] nothing to do")
-				continue //noting to do
+	if job.tHeightSync {
+		if gapTo := checkHeightGap(txSource, blockHeightOld, sLogSep); gapTo > 0 {
+			gaps = addGap(gaps, heightRange{from: blockHeightOld + 1, to: gapTo})
+			txSource.synced(gapTo)
+		}
+	}
+
+	//=== where each stream resumes: from the page holding its last tx count (checked for pruning) or above our last height
+	for k := range streams {
+		log.Println(sLogSep + "   Stream " + streams[k].query.String())
+		if job.tHeightSync {
+			startStreamByHeight(txSource, &streams[k], blockHeightOld, cfg, sLogSep)
+		} else {
+			startStream(txSource, &streams[k], blockHeightOld, cfg, sLogSep)
+		}
+		if streams[k].gapTo > 0 {
+			gaps = addGap(gaps, heightRange{from: blockHeightOld + 1, to: streams[k].gapTo})
+			txSource.synced(streams[k].gapTo) //the node pruned them, the archive nodes are asked for them
+		}
+	}
+
+	//=== fetch the heights the nodes pruned before we got them from the archive nodes (before the new txs are appended,
+	//    the rows of former runs' gaps are merged in height order)
+	gaps = backfillGaps(job, cfg, streams, ourPubKey, gaps)
+	saveGaps(gapsFile(chainName, ourAddr), gaps)
+
+	//=== fetch the new txs page by page, each page's rows are written right away
+	if syncStreams(job, cfg, txSource, streams, blockHeightOld, ourPubKey) == 0 {
+		log.Println(sLogSep + "   [OK] nothing to do")
+	}
+} //syncAddress
+
+// fetches the new txs of the streams page by page, always of the stream fetched least far. After each page the txs all
+// streams are fetched up to are merged (a tx may be in several streams) in height order and written, and the count files
+// updated, to prevent loss in case of errors. Returns the number of new txs.
+func syncStreams(job *syncJob, cfg *configData.Cfg, txSource TxSource, streams []txStream, blockHeightOld int, ourPubKey string) int {
+	var nNewTxs int
+
+	for {
+		next := -1
+		for k := range streams {
+			if !streams[k].tDone && (next < 0 || streams[k].height < streams[next].height) {
+				next = k
 			}
+		}
+		if next >= 0 {
+			streams[next].fetchPage(txSource, job.tHeightSync, cfg, job.sLogSep)
+		}
+
+		//the height all streams are fetched up to: the next page of a stream may hold further txs of its last height
+		heightDone := math.MaxInt
+		for k := range streams {
+			if !streams[k].tDone {
+				heightDone = utils.MinInt(heightDone, streams[k].height-1)
+			}
+		}
+
+		newTxs := []TxResp{}
+		for k := range streams {
+			n := 0
+			for n < len(streams[k].pending) && heightOf(&streams[k].pending[n]) <= heightDone {
+				n++
+			}
+			newTxs = mergeTxs(newTxs, streams[k].pending[:n], streams[k].tIncoming)
+			streams[k].pending = streams[k].pending[n:]
+		}
+
+		if len(newTxs) > 0 {
+			writeTaxRows(job, cfg, newTxs, blockHeightOld, ourPubKey, false) //false: append to the csv
+			nNewTxs += len(newTxs)
+		}
+		if fs, ok := txSource.(*failoverSource); ok && heightDone < math.MaxInt {
+			fs.synced(heightDone)
+		}
+		if !job.tHeightSync {
+			updateStreamCounts(streams)
+		}
 
-			allNewTaxCsvRows := []*taxcsv.TaxCsv{}
+		if next < 0 {
+			return nNewTxs
+		}
+	}
+} //syncStreams
 
-			pageTotal = int(math.Ceil(float64(totalCount) / float64(pageLimit))) //with limit 1 totalPages would be totalCount
-			utils.ErrDefaultFatal(err)                                           //on err log.Fatal with details
+// processes the txs in chunks of about pageLimit txs and writes each chunk's result to csv right away; a chunk never splits
+// a height, as the next run restarts after the last written height (the tx counts, updated by the caller once all are
+// written, may lag behind it). tMerge: insert the rows in height order (backfilled txs) instead of appending them
+func writeTaxRows(job *syncJob, cfg *configData.Cfg, newTxs []TxResp, blockHeightOld int, ourPubKey string, tMerge bool) {
+	pageLimit := cfg.Query.PageLimit
+	sLogSep := job.sLogSep
+	csvFile := job.chainI.ChainName + "_" + job.ourAddr + ".csv"
 
-			//page to use in query
-			page = int(math.Floor(float64(txCountOld)/float64(pageLimit))) + 1
+	for iStart := 0; iStart < len(newTxs); {
+		iEnd := utils.MinInt(iStart+pageLimit, len(newTxs))
+		for iEnd < len(newTxs) && newTxs[iEnd].Height == newTxs[iEnd-1].Height {
+			iEnd++
+		}
 
-			if page > pageTotal {
-				continue //this should not happen, would be catched by totalCount above
+		//get []*taxcsv.TaxCsv holding the relevant rows
+		newTaxCsvRows := processRecTxs(&TxsResp{Txs: newTxs[iStart:iEnd]}, blockHeightOld, job.ourAddr, ourPubKey, cfg, job.networkIdx, sLogSep)
+
+		//=== add FIAT base value for receivedAmount and feeAmount ()
+		if len(newTaxCsvRows) > 0 {
+			log.Println(sLogSep + "       [I] Getting Fiat conversion for received and fee amounts")
+
+			//do the conversion for all rows, each with the trade pairs of its asset
+			exch.AddFiatBaseInfo2TaxCsvData(cfg.GetNetworkAssets(job.networkIdx), newTaxCsvRows, cfg.FiatDecimals, sLogSep+"          ")
+
+			//=== append (merge) new rows to csv file
+			if tMerge {
+				taxcsv.MergeTaxRows(csvFile, newTaxCsvRows)
+			} else {
+				taxcsv.AppendNewTaxRows(csvFile, newTaxCsvRows)
 			}
+		}
+
+		log.Println(sLogSep + "       [OK] txs done: " + strconv.Itoa(iEnd) + "/" + strconv.Itoa(len(newTxs)))
+		iStart = iEnd
+	}
+} //writeTaxRows
 
-			for {
-				//query 1st bunch
-				txsResp := &TxsResp{}
-				log.Println("   [I] querying page: " + strconv.Itoa(page) + "/" + strconv.Itoa(pageTotal) + " - this may take some time!")
+// placeholder for the pubkey in addrTemplate.yaml
+const pubKeyPlaceholder = "yourPubKey"
 
-				//=== sometimes result is illformed; retry in these cases, break if error-free result
-				for iRetry := 0; iRetry <= cfg.Query.Nretry; iRetry++ {
-					//--- query txs
-					//log.Println("Query command used:")
-					//log.Println(chainInfos[networkIdx].DaemonName + " query" + " txs" + " --events" + " 'message.sender=" + ourAddr + "'" + " --page " + strconv.Itoa(page) + " --limit " + strconv.Itoa(pageLimit) + " -out" + " json")
-					out, err := exec.Command(chainInfos[networkIdx].DaemonName, "query", "txs", "--events", "'message.sender="+ourAddr+"'", "--page", strconv.Itoa(page), "--limit", strconv.Itoa(pageLimit), "-out", "json").CombinedOutput()
-					if err != nil {
-						//s := string(out)
-						//err = fmt.Errorf("%w; %v", err, s)
-						//utils.ErrDefaultFatal(err) //on err log.Fatal with detail
+// max pages of the sender query searched for a tx the address signed, when the account query gives no pubkey
+const maxPubKeySearchPages = 10
 
-						if iRetry < cfg.Query.Nretry {
-							// try again
-							log.Println("       Err in retrieving query result, retrying!")
-							time.Sleep(time.Second * time.Duration(cfg.Query.Tretry))
-							continue
-						} else {
-							// fail with details
-							s := string(out)
-							err = fmt.Errorf("%w; %v", err, s)
-							utils.ErrDefaultFatal(err) //on err log.Fatal with detail
-						}
-					}
+// the pubkey of our address. A pubkey given in addr.yaml (optional) has to belong to the address: checked by deriving
+// the address from it, or for keys with a different derivation (e.g. ethsecp256k1) by the pubkey the chain knows.
+// Without a given pubkey, it is looked up on chain: the auth module's account, otherwise the first tx the address signed.
+// "" if the address never signed a tx. The queries are retried (queryRetrying), as without the pubkey we could not tell
+// the fees we paid.
+func resolvePubKey(txSource TxSource, ourAddr string, cfgPubKey string, cfg *configData.Cfg, sLogSep string) string {
+	var chainPubKey string
 
-					err = json.Unmarshal(out, &txsResp)
-					if err != nil {
-						if iRetry < cfg.Query.Nretry {
-							// try again
-							log.Println("       Err in unmarshalling query result, retrying!")
-							time.Sleep(time.Second * time.Duration(cfg.Query.Tretry))
-							continue
-						} else {
-							// fail with details
-							utils.ErrDefaultFatal(err) //on err log.Fatal with details
-						}
-					}
+	if cfgPubKey == pubKeyPlaceholder {
+		cfgPubKey = ""
+	}
+	if cfgPubKey != "" && address.MatchesPubKey(ourAddr, cfgPubKey) {
+		log.Println(sLogSep + "      [OK] pubKey given matches the address")
+		return cfgPubKey
+	}
 
-					// down here means successfully retriefed and unmarshalled, we can exit the loop
-					break
-				}
+	queryRetrying(txSource, "account query", cfg, sLogSep, func() (err error) {
+		chainPubKey, err = txSource.AccountPubKey(ourAddr)
+		return err
+	})
+	if chainPubKey == "" {
+		chainPubKey = firstSignedTxPubKey(txSource, ourAddr, cfg, sLogSep)
+	}
 
-				//get []*taxcsv.TaxCsv holding the relevant rows
-				newTaxCsvRows := processRecTxs(txsResp, blockHeightOld, ourAddr, ourPubKey, cfg, networkIdx)
-				if len(newTaxCsvRows) > 0 {
-					allNewTaxCsvRows = append(allNewTaxCsvRows, newTaxCsvRows...)
+	switch {
+	case cfgPubKey != "" && cfgPubKey != chainPubKey:
+		if chainPubKey == "" {
+			log.Fatal("pubKey " + cfgPubKey + " given in addr.yaml does not belong to address " + ourAddr + " (derives an other address; no pubkey found on chain). " + utils.FatalDetails())
+		}
+		log.Fatal("pubKey " + cfgPubKey + " given in addr.yaml does not belong to address " + ourAddr + ", its pubkey on chain is " + chainPubKey + ". " + utils.FatalDetails())
+	case cfgPubKey != "":
+		log.Println(sLogSep + "      [OK] pubKey given matches the account's pubkey on chain")
+	case chainPubKey != "":
+		log.Println(sLogSep + "      [I] pubKey discovered on chain: " + chainPubKey)
+	default:
+		log.Println(sLogSep + "      [I] no pubKey found, the address never signed a tx -> syncing the txs in which it received coins")
+	}
 
-					//increase counter for per page write - below set to totalcount if all was successful
-					txCountOld = txCountOld + len(newTaxCsvRows)
-				} else {
-					// this happens e.g. after pruning: we do not process a single entry, this means we need to increase total count
-					// from received (but not new entries)
-					txRecieved, err = strconv.Atoi(txsResp.Count)
-					utils.ErrDefaultFatal(err)
-					txCountOld = txCountOld + txRecieved
+	return chainPubKey
+}
+
+// the pubkey of the first tx signed by the address (its signer info's key derives the address); "" if none found
+func firstSignedTxPubKey(txSource TxSource, ourAddr string, cfg *configData.Cfg, sLogSep string) string {
+	query := SenderQuery(ourAddr)
+
+	for page := 1; page <= maxPubKeySearchPages; page++ {
+		txsResp := queryPageRetrying(txSource, query, page, cfg, sLogSep)
+
+		for _, tx := range txsResp.Txs {
+			for _, signerInfo := range tx.Tx.AuthInfo.SignerInfos {
+				if signerInfo.PublicKey.Key != "" && address.MatchesPubKey(ourAddr, signerInfo.PublicKey.Key) {
+					return signerInfo.PublicKey.Key
 				}
+			}
+		}
 
-				//println(len(newTaxCsvRows))
+		if len(txsResp.Txs) == 0 || txsResp.PageNumber == txsResp.PageTotal {
+			break
+		}
+	}
+	return ""
+}
 
-				//=== Process each pages'result to csv immediately to prevent loss in case of errors
-				//=== add FIAT base value for receivedAmount and feeAmount ()
-				nNewRows := len(allNewTaxCsvRows)
-				if len(allNewTaxCsvRows) > 0 {
-					sLogSep = "       "
-					log.Println(sLogSep + "[I] Getting Fiat conversion for received and fee amounts")
+// message types we look into
+const (
+	msgTypeUnknown        = "unknown" //fee row of a tx whose body and logs name no message
+	MsgTypeExec           = "/cosmos.authz.v1beta1.MsgExec"
+	MsgTypeWithdrawReward = "/cosmos.distribution.v1beta1.MsgWithdrawDelegatorReward"
+	MsgTypeDelegate       = "/cosmos.staking.v1beta1.MsgDelegate"
+)
 
-					//get trade pairs sub struct for conversion
-					tradePairs4Tax = &cfg.Networks[networkIdx].TradePairs4Tax
+// sync modes, as given by syncMode in config.yaml
+const (
+	SyncModeCount  = "count"  //resume via the persisted tx count (with pruning hypothesis check)
+	SyncModeHeight = "height" //resume from the last height in the csv via tx.height conditions; no count file needed
+)
 
-					//do the conversion for all rows
-					exch.AddFiatBaseInfo2TaxCsvData(tradePairs4Tax, allNewTaxCsvRows, sLogSep+"   ")
+// one query for an address, with its own persisted tx count
+type txStream struct {
+	query       TxQuery
+	countFile   string
+	tIncoming   bool     //txs others sent to us
+	totalCount  int      //as reported by the node in this run
+	gapTo       int      //>0: the node pruned the heights after our last one up to this, before we fetched them
+	page        int      //next page to fetch
+	pageTotal   int      //
+	txCount     int      //count mode: tx count of the last tx fetched
+	height      int      //of the last tx fetched
+	heightKnown int      //txs up to it are fetched already: blockHeightOld, after a resync also the ones fetched before
+	pending     []TxResp //new txs fetched, not yet written
+	tDone       bool     //all pages fetched
+}
 
-					//=== append new rows to csv file
-					taxcsv.AppendNewTaxRows(network.ChainName+"_"+ourAddr+".csv", allNewTaxCsvRows)
+// count mode: checks the stream's last tx count against the node (pruning) and sets the page holding it to resume from
+func startStream(txSource TxSource, stream *txStream, blockHeightOld int, cfg *configData.Cfg, sLogSep string) {
+	var txCountOld, txCountUsed int
 
-					//=== empty the slice
-					allNewTaxCsvRows = []*taxcsv.TaxCsv{}
+	log.Println(sLogSep + "   Checking totalCount hypothesis")
 
-					//=== update lastCount from totalCount in case last page - to enforce matching this value
-					if txsResp.PageNumber == txsResp.PageTotal {
-						// old approach when first collecting all pages
-						txCountOld, err = strconv.Atoi(txsResp.TotalCount)
-						utils.ErrDefaultFatal(err)
-					}
+	//=== get tx count we reached last time
+	txCountOld = taxcsv.GetLastTxCount(stream.countFile)
 
-					//write every page's data -> update txCountOld to number of used elements from the current page
-					txCountOld = txCountOld + nNewRows //
+	//=== hypothesis check (without rows in the csv there is no height to check the count against: start from the first tx)
+	if txCountOld != 0 && blockHeightOld == 0 {
+		log.Println(sLogSep + "      [W] no rows in the csv for txCountOld -> starting from the first tx")
+		txCountOld = 0
+	}
+	stream.heightKnown = blockHeightOld
+	txCountUsed = stream.resumeCount(txSource, txCountOld, cfg, sLogSep)
+
+	log.Println(sLogSep + "      [I] using txCount/totalCount: " + strconv.Itoa(txCountUsed) + "/" + strconv.Itoa(stream.totalCount))
+	stream.setPage(txCountUsed, cfg)
+} //startStream
+
+// the node's total count of the stream and the tx count to resume from: txCountOld checked against heightKnown (pruning).
+// Nodes count differently -> checked again if another node took over in between
+func (stream *txStream) resumeCount(txSource TxSource, txCountOld int, cfg *configData.Cfg, sLogSep string) int {
+	var txCountUsed int
+
+	for {
+		poolIdx := poolIdxOf(txSource)
+
+		//=== get only 1 tx to get header info about nr of total transactions
+		stream.totalCount = queryTotalCount(txSource, stream.query, cfg, sLogSep)
+		log.Println(sLogSep + "      [I] txCountOld/totalCount: " + strconv.Itoa(txCountOld) + "/" + strconv.Itoa(stream.totalCount))
+
+		txCountUsed = txCountOld
+		stream.gapTo = 0
+		if stream.totalCount == 0 {
+			txCountUsed = 0
+		} else if txCountOld != 0 {
+			blockHeight := queryHeight(txSource, stream.query, stream.totalCount, cfg, sLogSep)
+			txCountUsed, stream.gapTo = checkHypothesisUpdateTxCount(txCountOld, stream.totalCount, blockHeight, stream.heightKnown, txSource, stream.query, cfg, sLogSep)
+			//it is ensured that txCountUsed<=totalcount and in case they match, that also blockHeights match!
+		}
 
-					//write to file
-					taxcsv.UpdateLastTxCount(network.ChainName+"_"+ourAddr+"_count.txt", txCountOld)
+		if poolIdxOf(txSource) == poolIdx {
+			return txCountUsed
+		}
+		log.Println(sLogSep + "      [I] node " + servedNode(txSource) + " took over meanwhile -> checking again on it")
+	}
+} //resumeCount
 
-					log.Println("       [OK] page done, txCount now: " + strconv.Itoa(txCountOld))
-				}
+// resume after txCount: from the page holding it
+func (stream *txStream) setPage(txCount int, cfg *configData.Cfg) {
+	pageLimit := cfg.Query.PageLimit
 
-				if txsResp.PageNumber == txsResp.PageTotal {
-					break // the loop over new pages
-				}
+	//=== new txs not yet retrieved?
+	stream.txCount = txCount
+	stream.tDone = stream.totalCount == txCount
 
-				//increase page
-				page += 1
+	stream.pageTotal = int(math.Ceil(float64(stream.totalCount) / float64(pageLimit))) //with limit 1 totalPages would be totalCount
 
-			} //for over the pages
+	//page to use in query
+	stream.page = int(math.Floor(float64(txCount)/float64(pageLimit))) + 1
+}
 
-			//once all has been done update totalcount file with true totalCount
-			taxcsv.UpdateLastTxCount(network.ChainName+"_"+ourAddr+"_count.txt", totalCount)
+// height mode: restricts the stream's query to the heights above blockHeightOld
+func startStreamByHeight(txSource TxSource, stream *txStream, blockHeightOld int, cfg *configData.Cfg, sLogSep string) {
+	pageLimit := cfg.Query.PageLimit
 
-		} //for over networks addresses in cfgAdr
+	stream.heightKnown = blockHeightOld
+	stream.query.MinHeight = blockHeightOld + 1
 
-	} // for over the networks
+	//=== get only 1 tx to get header info about nr of new transactions
+	stream.totalCount = queryTotalCount(txSource, stream.query, cfg, sLogSep)
+	log.Println(sLogSep + "      [I] new txs since height " + strconv.Itoa(blockHeightOld) + ": " + strconv.Itoa(stream.totalCount))
 
-	log.Println("[OK] Querying networks for txs ==================================================================")
+	stream.page = 1
+	stream.pageTotal = int(math.Ceil(float64(stream.totalCount) / float64(pageLimit)))
+	stream.tDone = stream.totalCount == 0
+} //startStreamByHeight
 
-} //GetProcessTxsForNetworks
+// fetches the stream's next page; its txs above heightKnown are kept to be written. If a node took over while fetching
+// it, its total count has to match ours, otherwise the pages are numbered differently and the stream is resynced on it
+func (stream *txStream) fetchPage(txSource TxSource, tHeightSync bool, cfg *configData.Cfg, sLogSep string) {
+	var txsResp *TxsResp
+
+	for {
+		poolIdx := poolIdxOf(txSource)
+		log.Println(sLogSep + "   [I] querying page: " + strconv.Itoa(stream.page) + "/" + strconv.Itoa(stream.pageTotal) + servedBy(txSource) + " - this may take some time!")
+		txsResp = queryPageRetrying(txSource, stream.query, stream.page, cfg, sLogSep)
 
-func processRecTxs(txsResp *TxsResp, blockHeightOld int, ourAddr string, ourPubKey string, cfg *configData.Cfg, networkIdx int) []*taxcsv.TaxCsv {
+		totalCount, err := strconv.Atoi(txsResp.TotalCount)
+		utils.ErrDefaultFatal(err) //on err log.Fatal with details
+		if poolIdxOf(txSource) == poolIdx || totalCount == stream.totalCount {
+			break
+		}
+		log.Println(sLogSep + "      [W] node " + servedNode(txSource) + " has a totalCount of " + strconv.Itoa(totalCount) + " instead of " + strconv.Itoa(stream.totalCount) + " -> resyncing the stream's page on it")
+		stream.resync(txSource, tHeightSync, cfg, sLogSep)
+		if stream.tDone {
+			return
+		}
+	}
+
+	//--- keep only txs newer than what we have (the first page usually holds some we already have)
+	for _, tx := range txsResp.Txs {
+		stream.height = heightOf(&tx)
+		if stream.height > stream.heightKnown {
+			stream.pending = append(stream.pending, tx)
+		}
+	}
+	stream.txCount = (stream.page-1)*cfg.Query.PageLimit + len(txsResp.Txs)
+
+	stream.tDone = len(txsResp.Txs) == 0 || txsResp.PageNumber == txsResp.PageTotal || stream.page >= stream.pageTotal
+	stream.page += 1
+} //fetchPage
+
+// finds the page to resume from on a node counting the stream's txs differently: the txs of the last height fetched may
+// continue on the next page -> they are fetched again, the ones below are known
+func (stream *txStream) resync(txSource TxSource, tHeightSync bool, cfg *configData.Cfg, sLogSep string) {
+	n := len(stream.pending)
+	for n > 0 && heightOf(&stream.pending[n-1]) == stream.height {
+		n--
+	}
+	txCountKnown := stream.txCount - (len(stream.pending) - n) //as counted by the node before
+	stream.pending = stream.pending[:n]
+	stream.heightKnown = utils.MaxInt(stream.heightKnown, stream.height-1)
+
+	if tHeightSync {
+		stream.query.MinHeight = stream.heightKnown + 1
+		for {
+			poolIdx := poolIdxOf(txSource)
+			stream.totalCount = queryTotalCount(txSource, stream.query, cfg, sLogSep)
+			if poolIdxOf(txSource) == poolIdx {
+				break
+			}
+		}
+		log.Println(sLogSep + "      [I] new txs since height " + strconv.Itoa(stream.heightKnown) + ": " + strconv.Itoa(stream.totalCount))
+		stream.setPage(0, cfg)
+		return
+	}
+
+	txCountUsed := stream.resumeCount(txSource, txCountKnown, cfg, sLogSep)
+	log.Println(sLogSep + "      [I] using txCount/totalCount: " + strconv.Itoa(txCountUsed) + "/" + strconv.Itoa(stream.totalCount))
+	stream.setPage(txCountUsed, cfg)
+} //resync
+
+// reports if the node pruned heights we have not fetched yet -> the txs therein are missing in the csv; returns the last
+// height of the gap (0: no gap)
+func checkHeightGap(txSource TxSource, blockHeightOld int, sLogSep string) int {
+	earliestHeight, err := txSource.EarliestHeight()
+	if err != nil {
+		log.Println(sLogSep + "      [W] could not get the node's earliest height, can not check for a gap: " + err.Error())
+		return 0
+	}
+
+	if earliestHeight > blockHeightOld+1 {
+		log.Println(sLogSep + "      [WARN] gap: the node's earliest height is " + strconv.Itoa(earliestHeight) + ", our last height is " + strconv.Itoa(blockHeightOld))
+		log.Println(sLogSep + "             -> txs in heights " + strconv.Itoa(blockHeightOld+1) + "-" + strconv.Itoa(earliestHeight-1) + " are MISSING in the csv, they are fetched from the archive nodes (archiveNodes in config.yaml)")
+		return earliestHeight - 1
+	}
+	log.Println(sLogSep + "      [OK] node covers our last height (earliest height: " + strconv.Itoa(earliestHeight) + ")")
+	return 0
+}
+
+// queries a page; sometimes result is illformed -> retry in these cases (queryRetrying)
+func queryPageRetrying(txSource TxSource, query TxQuery, page int, cfg *configData.Cfg, sLogSep string) *TxsResp {
+	var txsResp *TxsResp
+
+	queryRetrying(txSource, "page "+strconv.Itoa(page), cfg, sLogSep, func() (err error) {
+		txsResp, err = txSource.Page(query, page, cfg.Query.PageLimit)
+		return err
+	})
+
+	decodeTxsEvents(txsResp)
+	return txsResp
+}
+
+// runs a query; sometimes it fails or the result is illformed -> retry in these cases, fatal if the retries are
+// exhausted. If it keeps failing on a node (failoverAfter tries, fewer if the retries end before), we continue on the next
+// node of the network's pool, which gets nRetry retries of its own
+func queryRetrying(txSource TxSource, what string, cfg *configData.Cfg, sLogSep string, query func() error) {
+	err := tryRetrying(txSource, what, false, cfg, sLogSep, query)
+	// fail with details
+	utils.ErrDefaultFatal(err) //on err log.Fatal with detail
+}
+
+// runs a query like queryRetrying, but returns its error once the retries are exhausted. tNodesLeft: the caller has other
+// nodes to continue on (e.g. the next archive node) -> the error is returned after failoverAfter tries already
+func tryRetrying(txSource TxSource, what string, tNodesLeft bool, cfg *configData.Cfg, sLogSep string, query func() error) error {
+	var nFailed int //on the current node
+	tPoolLeft := true
+
+	failoverAfter := cfg.Query.FailoverAfter
+	if failoverAfter <= 0 {
+		failoverAfter = defaultFailoverAfter
+	}
+
+	for {
+		err := query()
+		if err == nil {
+			// successfully retrieved and unmarshalled
+			return nil
+		}
+		nFailed++
+
+		if fs, ok := txSource.(*failoverSource); ok && tPoolLeft && (nFailed >= failoverAfter || nFailed > cfg.Query.Nretry) {
+			failedNode := fs.Node()
+			if fs.failover(sLogSep) {
+				log.Println(sLogSep + "      [W] " + what + " failed " + strconv.Itoa(nFailed) + " times on " + failedNode + " (" + err.Error() + ") -> continuing on node " + fs.Node())
+				nFailed = 0
+				continue //no need to wait for an other node
+			}
+			tPoolLeft = false
+		}
+
+		if nFailed > cfg.Query.Nretry || (tNodesLeft && nFailed >= failoverAfter) {
+			return err
+		}
+		// try again
+		log.Println(sLogSep + "       Err in retrieving query result, retrying!")
+		time.Sleep(time.Second * time.Duration(cfg.Query.Tretry))
+	}
+}
+
+// the index of the node queried in the network's pool; changes when failing over
+func poolIdxOf(txSource TxSource) int {
+	if fs, ok := txSource.(*failoverSource); ok {
+		return fs.poolIdx
+	}
+	return 0
+}
+
+// " from <node>" for the log, if the source has nodes
+func servedBy(txSource TxSource) string {
+	if node := servedNode(txSource); node != "" {
+		return " from " + node
+	}
+	return ""
+}
+
+// the node queried; "" if the source has none
+func servedNode(txSource TxSource) string {
+	if fs, ok := txSource.(*failoverSource); ok {
+		return fs.Node()
+	}
+	return ""
+}
+
+// adds the stream's txs not yet present (same tx hash) and keeps all in height order
+func mergeTxs(txs []TxResp, streamTxs []TxResp, tIncoming bool) []TxResp {
+	var hashes = map[string]bool{}
+	for _, tx := range txs {
+		hashes[tx.TxHash] = true
+	}
+
+	for _, tx := range streamTxs {
+		if hashes[tx.TxHash] {
+			continue
+		}
+		hashes[tx.TxHash] = true
+		tx.TIncoming = tIncoming
+		txs = append(txs, tx)
+	}
+
+	sort.SliceStable(txs, func(a, b int) bool {
+		return heightOf(&txs[a]) < heightOf(&txs[b])
+	})
+	return txs
+}
+
+func heightOf(tx *TxResp) int {
+	height, err := strconv.Atoi(tx.Height)
+	utils.ErrDefaultFatal(err)
+	return height
+}
+
+// the tx count of the streams' last tx written (the ones fetched, but not yet written, follow it)
+func updateStreamCounts(streams []txStream) {
+	for _, stream := range streams {
+		taxcsv.UpdateLastTxCount(stream.countFile, utils.MaxInt(stream.txCount-len(stream.pending), 0))
+	}
+}
+
+func processRecTxs(txsResp *TxsResp, blockHeightOld int, ourAddr string, ourPubKey string, cfg *configData.Cfg, networkIdx int, sLogSep string) []*taxcsv.TaxCsv {
 
 	taxRelMessageTypes := cfg.TaxRelevantMessageTypes
 	newTaxCsvRows := []*taxcsv.TaxCsv{}
 	var newTaxCsvRow *taxcsv.TaxCsv
-	var tAtt, tMess, tWeSigned bool
-	var currMess, s1, s2 string
-	var n1, n2, n3 int
-	var feeAmount, recAmount float64
+	var tAtt, tWePaid bool
+	var currMess string
+	var msgAction string //first action of the current message
+	var txAction string  //first action of the tx's messages
+	var feeAmount coins.Dec
+	var recAmounts *denomAmounts  //received amounts (base units) of the current message per denom
+	var recTransfers []string     //the single received amounts (as given in the events) of the current message
+	var rewardRecs []rewardRecord //withdraw_rewards/withdraw_commission of the current message
 	var feeCurrency string
-	var tAddedFees, tCoinReceived, tFeeRow, tFeesToBeAdded bool
+	var feeAmountBase coins.Dec     //fee in base units, allocated to the tax relevant messages
+	var msgRowGroups []*msgRowGroup //rows of the tx's messages, written once the fee is allocated
+	var tAddedFees, tCoinReceived, tFeesToBeAdded bool
 
 	for _, tx := range txsResp.Txs {
 		//--- check for blockheight newer than what we have
@@ -280,29 +764,23 @@ func processRecTxs(txsResp *TxsResp, blockHeightOld int, ourAddr string, ourPubK
 			continue
 		}
 
-		//log.Println("Processing height " + tx.Height)
+		//log.Println(sLogSep + "Processing height " + tx.Height)
 
 		//if heightInt == {
 		//	println("Debug")
 		//}
 		//--------------------------------------------------------------
 		//--- check for payed fees (if we paid)
-		feeAmount = 0.0
+		feeAmount = coins.Dec{}
 		feeCurrency = ""
-		tAddedFees = false //used below in cycle over events. strategy: add fees if we signed to first tax relevant message; in case there are several, the first has the fees; in case none, then teh fees are irrelevant
+		tAddedFees = false //used below in cycle over events. strategy: add fees if we paid to first tax relevant message; in case there are several, the first has the fees; in case none, then teh fees are irrelevant
 		tFeesToBeAdded = false
-		tWeSigned = false
 
-		//extract fee info
-		for _, signInfo := range tx.Tx.AuthInfo.SignerInfos {
-			if signInfo.PublicKey.Key == ourPubKey {
-				tWeSigned = true
-				break
-			}
-		}
+		//extract fee info: who paid (fee payer/granter or first signer)
+		tWePaid = weFeePayer(&tx, ourAddr, ourPubKey)
 
 		//process fee info
-		if tWeSigned {
+		if tWePaid {
 			if len(tx.Tx.AuthInfo.Fee.Amount) > 1 {
 				log.Fatal("More than one fee entries, while we expected exact one for tx with hash: " + tx.TxHash + " for network: " + cfg.Networks[networkIdx].Name + ". " + utils.FatalDetails())
 			}
@@ -311,9 +789,9 @@ func processRecTxs(txsResp *TxsResp, blockHeightOld int, ourAddr string, ourPubK
 				if tx.Tx.AuthInfo.Fee.Amount[0].Denom != cfg.Networks[networkIdx].FeeDenom {
 					log.Fatal("Fee denom: " + tx.Tx.AuthInfo.Fee.Amount[0].Denom + "does not match expected denom: " + cfg.Networks[networkIdx].FeeDenom + " for network: " + cfg.Networks[networkIdx].Name + ". " + utils.FatalDetails())
 				} else {
-					feeAmount, err = strconv.ParseFloat(tx.Tx.AuthInfo.Fee.Amount[0].Amount, 64)
+					feeAmountBase, err = coins.NewDecFromString(tx.Tx.AuthInfo.Fee.Amount[0].Amount)
 					utils.ErrDefaultFatal(err)
-					feeAmount = feeAmount / math.Pow10(cfg.Networks[networkIdx].Exponent)
+					feeAmount = feeAmountBase.Shift(-cfg.Networks[networkIdx].Exponent)
 					feeCurrency = cfg.Networks[networkIdx].Denom
 					tFeesToBeAdded = true
 				}
@@ -323,13 +801,36 @@ func processRecTxs(txsResp *TxsResp, blockHeightOld int, ourAddr string, ourPubK
 		//--- check for payed fees (if we paid)
 		//--------------------------------------------------------------
 
+		//--------------------------------------------------------------
+		//--- failed tx: no logs/message events, but the fee was paid anyhow -> fee-only row if we signed (and paid)
+		if tx.Code != 0 {
+			log.Println(sLogSep + "   [I] failed tx: " + tx.TxHash + " (code " + strconv.Itoa(tx.Code) + "): " + tx.RawLog)
+			if tFeesToBeAdded {
+				msgTypes := bodyMsgTypes(&tx, taxRelMessageTypes)
+				if len(msgTypes) == 0 && cfg.Networks[networkIdx].FeeRowsAllTxs {
+					msgTypes = bodyMsgTypes(&tx, nil)
+				}
+				if len(msgTypes) > 0 {
+					newTaxCsvRows = append(newTaxCsvRows, feeOnlyRow(&tx, msgTypes, taxcsv.CategoryFailed, feeAmount, feeCurrency, ourAddr, ourPubKey))
+				}
+			}
+			continue
+		}
+		//--- failed tx
+		//--------------------------------------------------------------
+
 		//--------------------------------------------------------------
 		//--- extract relevant event info's
 		//    be carefule: log contains several -events sections which each contains individial events (like 'coin_received')
-		for _, logEvents := range tx.Logs {
+		msgRowGroups = []*msgRowGroup{}
+		txAction = ""
+		for msgIdx, logEvents := range txMessageLogs(&tx, sLogSep) {
 
 			tCoinReceived = false
-			tFeeRow = false
+			msgAction = ""
+			recAmounts = newDenomAmounts()
+			recTransfers = []string{}
+			rewardRecs = []rewardRecord{}
 			//new data -> new empty row (only appended if MsgType matches)
 			newTaxCsvRow = new(taxcsv.TaxCsv)
 			newTaxCsvRow.Blockheight = heightInt
@@ -341,10 +842,12 @@ func processRecTxs(txsResp *TxsResp, blockHeightOld int, ourAddr string, ourPubK
 			newTaxCsvRow.Addr = ourAddr
 			newTaxCsvRow.Key = ourPubKey
 			newTaxCsvRow.ReceivedCurrency = cfg.Networks[networkIdx].Denom
+			newTaxCsvRow.Category = taxcsv.CategoryStaking
+			newTaxCsvRow.MsgIndex = msgIdx
 
 			for _, event := range logEvents.Events {
 
-				//log.Println("Event-type: " + event.Type)
+				//log.Println(sLogSep + "Event-type: " + event.Type)
 
 				// keep coin received infos in case it is a tex relevant tx (see message check)
 				if event.Type == "coin_received" {
@@ -352,7 +855,7 @@ func processRecTxs(txsResp *TxsResp, blockHeightOld int, ourAddr string, ourPubK
 					tAtt = false
 					for _, attr := range event.Attributes {
 
-						//log.Printf("Key: %v bool: %v attr.Value %v bool: %v", attr.Key, (attr.Key == "receiver"), attr.Value, (attr.Value == ourAddr))
+						//log.Printf(sLogSep+"Key: %v bool: %v attr.Value %v bool: %v", attr.Key, (attr.Key == "receiver"), attr.Value, (attr.Value == ourAddr))
 
 						if attr.Key == "receiver" && attr.Value == ourAddr {
 							tAtt = true //makr for next attr (is amount)
@@ -363,35 +866,12 @@ func processRecTxs(txsResp *TxsResp, blockHeightOld int, ourAddr string, ourPubK
 						//if previous attr was receiver and our addr was given
 						if attr.Key == "amount" && tAtt {
 							//this is received on ourAddr
-							//received is numberDenom
-							n1 = len(cfg.Networks[networkIdx].FeeDenom)
-							n2 = len(attr.Value)
-
-							//sometimes, extra text may preceede the actual value (e.g. some IBC info) -> we search for only number in front of the denom and stop at the first non-digit
-							n3 = n2 - n1 - 1 //right in front of denom
-							for {
-								if n3 < 0 {
-									break
-									//convert byte int8 to rune int32
-								} else if unicode.IsDigit(int32(attr.Value[n3])) {
-									n3 = n3 - 1
-								} else {
-									break
-								}
-							}
-							//n3 now at first non digit position or -1 0> shift by 1 for first digit
-							n3 = n3 + 1
-
-							s1 = attr.Value[n3 : n2-n1]
-							s2 = attr.Value[n2-n1:]
-
-							if s2 != cfg.Networks[networkIdx].FeeDenom {
-								log.Fatal("Received value denom: " + s2 + "does not match expected denom: " + cfg.Networks[networkIdx].FeeDenom + " for network: " + cfg.Networks[networkIdx].Name + ". " + utils.FatalDetails())
-							} else {
-								recAmount, err = strconv.ParseFloat(s1, 64)
-								utils.ErrDefaultFatal(err)
-								newTaxCsvRow.ReceivedAmount += recAmount / math.Pow10(cfg.Networks[networkIdx].Exponent)
+							//received is sdk.Coins: amountDenom[,amountDenom...], one row per denom is created below
+							err = recAmounts.addCoins(attr.Value)
+							if err != nil {
+								log.Println(sLogSep + "   [W] skipping received amount of tx: " + tx.TxHash + " for network: " + cfg.Networks[networkIdx].Name + ": " + err.Error())
 							}
+							recTransfers = append(recTransfers, attr.Value)
 
 						}
 
@@ -401,33 +881,47 @@ func processRecTxs(txsResp *TxsResp, blockHeightOld int, ourAddr string, ourPubK
 
 				}
 
-				//in message event look for action's value:
+				//rewards/commission paid out by the distribution module (per validator)
+				if event.Type == "withdraw_rewards" || event.Type == "withdraw_commission" {
+					rewardRecs = append(rewardRecs, parseRewardRecords(event)...)
+				}
+
+				//in message event look for action's value (since sdk 0.50 a message has several message events, not all with an action):
 				if event.Type == "message" {
-					tMess = false
 					for _, attr := range event.Attributes {
 						if attr.Key == "action" {
 							currMess = attr.Value
+							if msgAction == "" {
+								msgAction = currMess
+							}
+							if txAction == "" {
+								txAction = currMess
+							}
 							if slices.Contains(taxRelMessageTypes, currMess) {
-								tMess = true
-								if newTaxCsvRow.MsgType != "" {
-									log.Println("Warning: second message/action for tx: " + tx.TxHash + " for network: " + cfg.Networks[networkIdx].Name + ". " + utils.FatalDetails())
-									log.Println("	-> check this!")
+								//each message has its own log (resp. msg_index); a further action within it stems from inner messages (e.g. of MsgExec, see exec_msg_types)
+								if newTaxCsvRow.MsgType == "" {
+									newTaxCsvRow.MsgType = currMess
 								}
-								newTaxCsvRow.MsgType += currMess //append, as we might have a mulit message tx
-								//break
 							}
 						}
 					}
-					//if we did not find a tax relevant message, report the message type
-					if !tMess {
-						log.Println("   [I] skipping unhandled MsgType: " + currMess)
-					}
 				} // if event Message
 
 			} // for over events entries - the events: contents
 
+			//if we did not find a tax relevant action, report the message's one, once (incoming txs are handled below)
+			if newTaxCsvRow.MsgType == "" && msgAction != "" && !tx.TIncoming {
+				log.Println(sLogSep + "   [I] skipping unhandled MsgType: " + msgAction)
+			}
+
 			// continue for tax-irrelevant message type
 			if newTaxCsvRow.MsgType == "" {
+				//except for incoming txs signed by others: the coins we received are income
+				if tx.TIncoming && tCoinReceived {
+					newTaxCsvRow.MsgType = bodyMsgType(&tx, msgIdx)
+					newTaxCsvRow.Category = taxcsv.CategoryIncome
+					msgRowGroups = append(msgRowGroups, &msgRowGroup{rows: splitRowPerDenom(newTaxCsvRow, recAmounts, cfg, networkIdx, sLogSep), tCoinReceived: true})
+				}
 				continue
 			}
 
@@ -436,22 +930,48 @@ func processRecTxs(txsResp *TxsResp, blockHeightOld int, ourAddr string, ourPubK
 			//we already called continue above in case of irrelevant message
 			if newTaxCsvRow.MsgType != "" {
 
-				//once add the fees (to the first tax relevant row)
-				if !tAddedFees && tFeesToBeAdded {
-					//
-					newTaxCsvRow.FeeAmount = feeAmount
-					newTaxCsvRow.FeeCurrency = feeCurrency
-					tAddedFees = true //used below in cycle over events. strategy: add fees if we signed to first tax relevant message; in case there are several, the first has the fees; in case none, then teh fees are irrelevant
-					tFeeRow = true
+				//authz exec (e.g. restake): report the inner messages and who executed them
+				var bodyMsg *TxMessage
+				if msgIdx < len(tx.Tx.Body.Messages) {
+					bodyMsg = &tx.Tx.Body.Messages[msgIdx]
 				}
-				//--- append the row only if not blank
-				if tFeeRow || tCoinReceived {
-					newTaxCsvRows = append(newTaxCsvRows, newTaxCsvRow)
+				if bodyMsg != nil && bodyMsg.Type == MsgTypeExec {
+					addExecInfo(newTaxCsvRow, bodyMsg, ourAddr)
 				}
 
+				//the fee is allocated below, once all messages are known (weight for proportional allocation: received fee denom)
+				msgRowGroups = append(msgRowGroups, &msgRowGroup{
+					rows:          splitRowPerReward(newTaxCsvRow, recAmounts, recTransfers, rewardRecs, bodyMsg, ourAddr, cfg, networkIdx, sLogSep),
+					tCoinReceived: tCoinReceived,
+					tFeeTarget:    true,
+					weight:        recAmounts.amounts[cfg.Networks[networkIdx].FeeDenom],
+				})
+
 			}
 
 		} // for over events (the logs: -events)
+
+		//--- allocate the fee (if we paid) to the tax relevant messages; append the rows only if not blank
+		tAddedFees = false
+		if tFeesToBeAdded {
+			tAddedFees = allocateFee(msgRowGroups, feeAmountBase, cfg.FeeAllocation, cfg.Networks[networkIdx].Exponent, feeCurrency)
+		}
+		for _, group := range msgRowGroups {
+			if group.tCoinReceived || !group.rows[0].FeeAmount.IsZero() {
+				newTaxCsvRows = append(newTaxCsvRows, group.rows...)
+			}
+		}
+
+		//--- fee of a tx we signed without tax relevant messages (votes, sends, ibc transfers, ...), if configured
+		if tFeesToBeAdded && !tAddedFees && cfg.Networks[networkIdx].FeeRowsAllTxs {
+			msgTypes := bodyMsgTypes(&tx, nil)
+			if len(msgTypes) == 0 && txAction != "" {
+				msgTypes = []string{txAction}
+			} else if len(msgTypes) == 0 {
+				msgTypes = []string{msgTypeUnknown}
+			}
+			newTaxCsvRows = append(newTaxCsvRows, feeOnlyRow(&tx, msgTypes, taxcsv.CategoryFee, feeAmount, feeCurrency, ourAddr, ourPubKey))
+		}
 		//--- extract relevant event info
 		//--------------------------------------------------------------
 
@@ -460,9 +980,410 @@ func processRecTxs(txsResp *TxsResp, blockHeightOld int, ourAddr string, ourPubK
 	return newTaxCsvRows
 }
 
+// fee allocation strategies, as given by feeAllocation in config.yaml
+const (
+	FeeAllocationFirst        = "first"        //the whole fee to the first tax relevant message
+	FeeAllocationEven         = "even"         //split evenly over the tax relevant messages
+	FeeAllocationProportional = "proportional" //split proportional to the received amount (fee denom) of the messages; evenly if nothing received
+)
+
+// the rows of one message of a tx
+type msgRowGroup struct {
+	rows          []*taxcsv.TaxCsv //the fee share goes to the first row
+	tCoinReceived bool
+	tFeeTarget    bool      //tax relevant message, gets a share of the fee
+	weight        coins.Dec //for proportional fee allocation
+}
+
+// splits the fee (base units) over the tax relevant messages according to the strategy; the shares are exact
+// (integer base units) and add up to the fee. Returns false if there was no tax relevant message.
+func allocateFee(groups []*msgRowGroup, feeAmountBase coins.Dec, strategy string, exponent int, feeCurrency string) bool {
+	var targets []*msgRowGroup
+	var weights []coins.Dec
+	one, _ := coins.NewDecFromString("1")
+
+	for _, group := range groups {
+		if !group.tFeeTarget {
+			continue
+		}
+		targets = append(targets, group)
+		switch strategy {
+		case FeeAllocationProportional:
+			weights = append(weights, group.weight)
+		case FeeAllocationEven:
+			weights = append(weights, one)
+		default: //first
+			if len(weights) == 0 {
+				weights = append(weights, one)
+			} else {
+				weights = append(weights, coins.Dec{})
+			}
+		}
+	}
+	if len(targets) == 0 {
+		return false
+	}
+
+	for i, share := range coins.Split(feeAmountBase, weights) {
+		if share.IsZero() {
+			continue
+		}
+		targets[i].rows[0].FeeAmount = share.Shift(-exponent)
+		targets[i].rows[0].FeeCurrency = feeCurrency
+	}
+	return true
+}
+
+// sets the inner message types and the grantee of a MsgExec row. Restake bots execute the messages of many delegators
+// in one MsgExec, so only ours (by delegator address) are reported (all if none carries one).
+// Withdrawing rewards and delegating them again is tagged as auto-compounding.
+func addExecInfo(row *taxcsv.TaxCsv, execMsg *TxMessage, ourAddr string) {
+	var innerTypes, allTypes []string
+
+	for _, innerMsg := range execMsg.Msgs {
+		if !slices.Contains(allTypes, innerMsg.Type) {
+			allTypes = append(allTypes, innerMsg.Type)
+		}
+		if innerMsg.DelegatorAddress == ourAddr && !slices.Contains(innerTypes, innerMsg.Type) {
+			innerTypes = append(innerTypes, innerMsg.Type)
+		}
+	}
+	if len(innerTypes) == 0 {
+		innerTypes = allTypes
+	}
+
+	row.ExecMsgTypes = strings.Join(innerTypes, ";")
+	row.Grantee = execMsg.Grantee
+	if slices.Contains(innerTypes, MsgTypeWithdrawReward) && slices.Contains(innerTypes, MsgTypeDelegate) {
+		row.Category = taxcsv.CategoryAutoCompound
+	}
+}
+
+// whether our address paid the fee of the tx. The account the fee was deducted from is given in the tx event
+// (fee_payer, since sdk 0.47); otherwise the fee granter (feegrant, also in the use_feegrant event) pays if given,
+// then the explicit fee payer, else the first signer.
+func weFeePayer(tx *TxResp, ourAddr string, ourPubKey string) bool {
+	fee := &tx.Tx.AuthInfo.Fee
+
+	if feePayer := txEventAttr(tx.Events, "tx", "fee_payer"); feePayer != "" {
+		return feePayer == ourAddr
+	}
+	if fee.Granter != "" {
+		return fee.Granter == ourAddr
+	}
+	if granter := txEventAttr(tx.Events, "use_feegrant", "granter"); granter != "" {
+		return granter == ourAddr
+	}
+	if fee.Payer != "" {
+		return fee.Payer == ourAddr
+	}
+	return ourPubKey != "" && len(tx.Tx.AuthInfo.SignerInfos) > 0 && tx.Tx.AuthInfo.SignerInfos[0].PublicKey.Key == ourPubKey
+}
+
+// value of the first attribute key of an event of the given type ("" if not present)
+func txEventAttr(events []TxEvent, eventType string, key string) string {
+	for _, event := range events {
+		if event.Type != eventType {
+			continue
+		}
+		for _, attr := range event.Attributes {
+			if attr.Key == key {
+				return attr.Value
+			}
+		}
+	}
+	return ""
+}
+
+// the (distinct) message types of the tx body; only those in filter if given
+func bodyMsgTypes(tx *TxResp, filter []string) []string {
+	var msgTypes []string
+	for _, msg := range tx.Tx.Body.Messages {
+		if filter != nil && !slices.Contains(filter, msg.Type) {
+			continue
+		}
+		if !slices.Contains(msgTypes, msg.Type) {
+			msgTypes = append(msgTypes, msg.Type)
+		}
+	}
+	return msgTypes
+}
+
+// the type of the tx body's msgIdx'th message (the events of incoming txs do not always carry its action); "" if not in the body
+func bodyMsgType(tx *TxResp, msgIdx int) string {
+	if msgIdx < len(tx.Tx.Body.Messages) {
+		return tx.Tx.Body.Messages[msgIdx].Type
+	}
+	return ""
+}
+
+// row holding only the fee we paid for the tx (failed txs, txs without tax relevant messages)
+func feeOnlyRow(tx *TxResp, msgTypes []string, category string, feeAmount coins.Dec, feeCurrency string, ourAddr string, ourPubKey string) *taxcsv.TaxCsv {
+	height, err := strconv.Atoi(tx.Height)
+	utils.ErrDefaultFatal(err)
+
+	return &taxcsv.TaxCsv{
+		Timestamp:        tx.Timestamp,
+		Blockheight:      height,
+		MsgType:          strings.Join(msgTypes, ";"),
+		ReceivedCurrency: feeCurrency,
+		FeeAmount:        feeAmount,
+		FeeCurrency:      feeCurrency,
+		TxId:             tx.TxHash,
+		Addr:             ourAddr,
+		Key:              ourPubKey,
+		Category:         category,
+	}
+}
+
+// received amounts per denom, in order of appearance
+type denomAmounts struct {
+	denoms  []string
+	amounts map[string]coins.Dec
+}
+
+func newDenomAmounts() *denomAmounts {
+	return &denomAmounts{amounts: map[string]coins.Dec{}}
+}
+
+func (da *denomAmounts) add(denom string, amount coins.Dec) {
+	if _, ok := da.amounts[denom]; !ok {
+		da.denoms = append(da.denoms, denom)
+	}
+	da.amounts[denom] = da.amounts[denom].Add(amount)
+}
+
+// adds an sdk.Coins string like 12uatom,3ibc/27394FB...
+func (da *denomAmounts) addCoins(sCoins string) error {
+	amountCoins, err := coins.ParseCoins(sCoins)
+	if err != nil {
+		return err
+	}
+	for _, coin := range amountCoins {
+		amount, err := coins.NewDecFromString(coin.Amount)
+		if err != nil {
+			return err
+		}
+		da.add(coin.Denom, amount)
+	}
+	return nil
+}
+
+// the part of da which is not in sub (only denoms with a positive amount left)
+func (da *denomAmounts) without(sub *denomAmounts) *denomAmounts {
+	left := newDenomAmounts()
+	for _, denom := range da.denoms {
+		amount := da.amounts[denom].Sub(sub.amounts[denom])
+		if amount.Sign() > 0 {
+			left.add(denom, amount)
+		}
+	}
+	return left
+}
+
+// one payout of the distribution module: withdraw_rewards (amount, validator and since sdk 0.47 delegator)
+// or withdraw_commission (amount only)
+type rewardRecord struct {
+	amount      string
+	validator   string
+	delegator   string
+	tCommission bool
+}
+
+// a withdraw_rewards/withdraw_commission event may hold several payouts (one amount each, the logs until sdk 0.47
+// merge all events of a type of the message into one) -> a new record starts with every amount
+func parseRewardRecords(event TxEvent) []rewardRecord {
+	var recs []rewardRecord
+	for _, attr := range event.Attributes {
+		switch attr.Key {
+		case "amount":
+			recs = append(recs, rewardRecord{amount: attr.Value, tCommission: event.Type == "withdraw_commission"})
+		case "validator":
+			if len(recs) > 0 {
+				recs[len(recs)-1].validator = attr.Value
+			}
+		case "delegator":
+			if len(recs) > 0 {
+				recs[len(recs)-1].delegator = attr.Value
+			}
+		}
+	}
+	return recs
+}
+
+// splits the row of a tax relevant message into one row per validator (and denom) by the withdraw_rewards and
+// withdraw_commission events; the coins received apart from these are reported separately (category other_received).
+// Payouts are ours if their delegator is us, or (no delegator given, before sdk 0.47) if we received exactly their amount
+// in a transfer of this message (e.g. a restake MsgExec pays out the rewards of many delegators).
+// The fee (if any) stays on the first row.
+func splitRowPerReward(row *taxcsv.TaxCsv, recAmounts *denomAmounts, recTransfers []string, rewardRecs []rewardRecord, bodyMsg *TxMessage, ourAddr string, cfg *configData.Cfg, networkIdx int, sLogSep string) []*taxcsv.TaxCsv {
+	rows := []*taxcsv.TaxCsv{}
+	rewardAmounts := newDenomAmounts()
+	transfers := slices.Clone(recTransfers)
+
+	for _, rec := range rewardRecs {
+		recAmounts4Rec := newDenomAmounts()
+		err := recAmounts4Rec.addCoins(rec.amount)
+		if err != nil || len(recAmounts4Rec.denoms) == 0 {
+			continue //no payout (e.g. 0 rewards on delegate)
+		}
+
+		if rec.delegator != "" {
+			if rec.delegator != ourAddr {
+				continue
+			}
+		} else {
+			iTransfer := slices.Index(transfers, rec.amount)
+			if iTransfer < 0 {
+				continue
+			}
+			transfers = slices.Delete(transfers, iTransfer, iTransfer+1)
+		}
+
+		rewardRow := new(taxcsv.TaxCsv)
+		*rewardRow = *row
+		rewardRow.Validator = rec.validator
+		if rec.tCommission {
+			rewardRow.Category = taxcsv.CategoryCommission
+			if bodyMsg != nil {
+				rewardRow.Validator = bodyMsg.ValidatorAddress
+			}
+		}
+		rows = append(rows, splitRowPerDenom(rewardRow, recAmounts4Rec, cfg, networkIdx, sLogSep)...)
+		for _, denom := range recAmounts4Rec.denoms {
+			rewardAmounts.add(denom, recAmounts4Rec.amounts[denom])
+		}
+	}
+
+	//leftover: received, but not paid out as rewards (or all received if there were no payouts)
+	leftAmounts := recAmounts.without(rewardAmounts)
+	if len(leftAmounts.denoms) > 0 {
+		leftRow := new(taxcsv.TaxCsv)
+		*leftRow = *row
+		if len(rewardRecs) > 0 {
+			leftRow.Category = taxcsv.CategoryOtherReceived
+		}
+		rows = append(rows, splitRowPerDenom(leftRow, leftAmounts, cfg, networkIdx, sLogSep)...)
+	}
+
+	if len(rows) == 0 {
+		return append(rows, row) //fee row
+	}
+	for _, feeRow := range rows[1:] {
+		feeRow.FeeAmount = coins.Dec{}
+		feeRow.FeeCurrency = ""
+	}
+	return rows
+}
+
+// splits the row into one row per received denom, each with its own currency and exponent (see the network's assets).
+// The fee (if any) stays on the first row; without received coins the row is returned as is (fee row).
+func splitRowPerDenom(row *taxcsv.TaxCsv, recAmounts *denomAmounts, cfg *configData.Cfg, networkIdx int, sLogSep string) []*taxcsv.TaxCsv {
+	rows := []*taxcsv.TaxCsv{}
+	if len(recAmounts.denoms) == 0 {
+		return append(rows, row)
+	}
+
+	for i, denom := range recAmounts.denoms {
+		denomRow := new(taxcsv.TaxCsv)
+		*denomRow = *row
+		if i > 0 {
+			denomRow.FeeAmount = coins.Dec{}
+			denomRow.FeeCurrency = ""
+		}
+
+		if asset, ok := cfg.GetNetworkAsset(networkIdx, denom); ok {
+			denomRow.ReceivedCurrency = asset.Denom
+			denomRow.ReceivedAmount = recAmounts.amounts[denom].Shift(-asset.Exponent)
+		} else {
+			//untracked denom: unknown exponent -> keep base units (row stays unpriced)
+			log.Println(sLogSep + "   [I] received denom: " + denom + " (tx: " + row.TxId + ") is not tracked in the network's assets, keeping amount in base units")
+			denomRow.ReceivedCurrency = denom
+			denomRow.ReceivedAmount = recAmounts.amounts[denom]
+		}
+		rows = append(rows, denomRow)
+	}
+	return rows
+}
+
+// the events per message: the tx's logs, or for sdk 0.50 (no logs) the tx level events grouped by their msg_index;
+// tx level events without msg_index (fee payment, signatures) belong to no message
+func txMessageLogs(tx *TxResp, sLogSep string) []TxLog {
+	if len(tx.Logs) > 0 {
+		return tx.Logs
+	}
+
+	var msgLogs []TxLog
+	for _, event := range tx.Events {
+		for _, attr := range event.Attributes {
+			if attr.Key != "msg_index" {
+				continue
+			}
+			msgIdx, err := strconv.Atoi(attr.Value)
+			if err != nil || msgIdx < 0 {
+				log.Println(sLogSep + "   [W] invalid msg_index: " + attr.Value + " in tx: " + tx.TxHash)
+				break
+			}
+			for len(msgLogs) <= msgIdx {
+				msgLogs = append(msgLogs, TxLog{})
+			}
+			msgLogs[msgIdx].Events = append(msgLogs[msgIdx].Events, event)
+			break
+		}
+	}
+
+	return msgLogs
+}
+
+// tendermint 0.34 nodes (depending on their config) return event attributes base64 encoded -> decode them in place,
+// such that the matching of keys and values works for all nodes
+func decodeTxsEvents(txsResp *TxsResp) {
+	for i := range txsResp.Txs {
+		decodeEvents(txsResp.Txs[i].Events)
+		for j := range txsResp.Txs[i].Logs {
+			decodeEvents(txsResp.Txs[i].Logs[j].Events)
+		}
+	}
+}
+
+// an event's attributes are regarded as encoded, if all keys decode to a plain attribute name like "receiver";
+// plain keys do not decode (length, '_') or decode to binary garbage
+func decodeEvents(events []TxEvent) {
+	for i := range events {
+		attrs := events[i].Attributes
+		if len(attrs) == 0 {
+			continue
+		}
+
+		tEncoded := true
+		keys := make([]string, len(attrs))
+		for j, attr := range attrs {
+			key, err := base64.StdEncoding.DecodeString(attr.Key)
+			if err != nil || !reAttrKey.Match(key) {
+				tEncoded = false
+				break
+			}
+			keys[j] = string(key)
+		}
+		if !tEncoded {
+			continue
+		}
+
+		for j := range attrs {
+			attrs[j].Key = keys[j]
+			value, err := base64.StdEncoding.DecodeString(attrs[j].Value)
+			if err == nil {
+				attrs[j].Value = string(value)
+			}
+		}
+	}
+}
+
+var reAttrKey = regexp.MustCompile(`^[A-Za-z0-9_.-]+$`)
+
 //
-//returns correct txCount
-func checkHypothesisUpdateTxCount(txCountOld int, totalCount int, blockHeight int, blockHeightOld int, daemonName string, ourAddr string, txStepBack int) int {
+//returns correct txCount and, if the node pruned heights after blockHeightOld, the last of them (0: no gap)
+func checkHypothesisUpdateTxCount(txCountOld int, totalCount int, blockHeight int, blockHeightOld int, txSource TxSource, query TxQuery, cfg *configData.Cfg, sLogSep string) (int, int) {
 
 	//=== hypothesis check: blockHeightOld is from last tx we received for txCountOld; if there has been pruning in the meantime,
 	//	  this does not match anymore. Cases:
@@ -478,47 +1399,52 @@ func checkHypothesisUpdateTxCount(txCountOld int, totalCount int, blockHeight in
 
 	//=== check if ne need to scan backwards for tx
 	if totalCount < txCountOld {
-		log.Println("      [I] totalCount is smaller than txCountOld -> there has been pruning -> scanning (backwards) for matching and re-syncing txCount")
+		log.Println(sLogSep + "      [I] totalCount is smaller than txCountOld -> there has been pruning -> scanning (backwards) for matching and re-syncing txCount")
 		tUpdateTxCount = true
 
 	} else {
 		if totalCount > txCountOld {
 			//fetch blockHeight for our last count, to see if it matches
-			blockHeight = queryHeight(daemonName, ourAddr, txCountOld)
+			blockHeight = queryHeight(txSource, query, txCountOld, cfg, sLogSep)
 		}
 
 		if blockHeight == blockHeightOld {
-			log.Println("   [OK] totalCount matches txCountOld and blockHeights match")
+			log.Println(sLogSep + "   [OK] totalCount matches txCountOld and blockHeights match")
 
 		} else if blockHeight > blockHeightOld {
 			tUpdateTxCount = true
-			log.Println("      [I] blockHeight > blockHeightOld -> there has been pruning -> scanning (backwards) for matching tx and re-syncing txCount")
+			log.Println(sLogSep + "      [I] blockHeight > blockHeightOld -> there has been pruning -> scanning (backwards) for matching tx and re-syncing txCount")
 
 		} else {
 			//here we are left with blockHeight < blockHeightOld
-			log.Println("      [I] blockHeight < blockHeightOld -> there has been pruning formerly, but now we have more txs again -> we can however go on with txCountOld")
+			log.Println(sLogSep + "      [I] blockHeight < blockHeightOld -> there has been pruning formerly, but now we have more txs again -> we can however go on with txCountOld")
 		}
 
 	}
 
 	if !tUpdateTxCount {
 		txCountOldUpdated = txCountOld
-		return txCountOldUpdated
+		return txCountOldUpdated, 0
 	} else {
-		//start backward quering
-		//var txsRespThin *TxsResp
-		//get exact the totalCount tx, blockHeightOld should be equal to txsRespThin.Txs[0].Height
-		//txsRespThin = queryOneTx(chainInfos[i].DaemonName, ourAddr, totalCount)
+		//start backward quering: heights grow with the txCount, so we search the last txCount with a height <= blockHeightOld.
+		//First step back exponentially (txStepBack, doubled each cycle) until a height <= blockHeightOld is found, then
+		//bisect between it and the last txCount tried above -> O(log n) height queries instead of O(n)
 		var stepBackUsed int
+		var txCountAbove int //lowest txCount known to have a height > blockHeightOld
+		var heightFound int
 
 		//inint stepback
-		stepBackUsed = txStepBack
+		stepBackUsed = utils.MaxInt(cfg.Query.TxStepBack, 1)
 
-		//init with minimum of both as starting point
+		//init with minimum of both as starting point; its height is known: blockHeight (of totalCount, resp. txCountOld)
 		txCountOldUpdated = utils.MinInt(txCountOld, totalCount)
-		tFound = false
+		height = blockHeight
+		tFound = height <= blockHeightOld //only if totalCount < txCountOld: the node pruned down to our last tx
+		heightFound = height
+		txCountAbove = txCountOldUpdated + 1 //the last tx
 
-		for {
+		for !tFound && txCountOldUpdated > 1 {
+			txCountAbove = txCountOldUpdated
 
 			//go back at max to first tx that can be retrieved
 			if (txCountOldUpdated - stepBackUsed) >= 1 {
@@ -527,44 +1453,60 @@ func checkHypothesisUpdateTxCount(txCountOld int, totalCount int, blockHeight in
 				txCountOldUpdated = 1
 			}
 
-			log.Printf("          trying %v of %v", txCountOldUpdated, totalCount)
+			log.Printf(sLogSep+"          trying %v of %v", txCountOldUpdated, totalCount)
 
 			//query the height at this txCount
-			height = queryHeight(daemonName, ourAddr, txCountOldUpdated)
+			height = queryHeight(txSource, query, txCountOldUpdated, cfg, sLogSep)
 
 			if height <= blockHeightOld {
 				tFound = true
-				break
+				heightFound = height
+			}
+			stepBackUsed = stepBackUsed * 2
+		}
 
-			} else if txCountOldUpdated == 1 {
-				break
+		//bisect: txCountOldUpdated has a height <= blockHeightOld, txCountAbove a higher one
+		for tFound && txCountAbove-txCountOldUpdated > 1 {
+			txCountMid := (txCountOldUpdated + txCountAbove) / 2
+			log.Printf(sLogSep+"          trying %v of %v", txCountMid, totalCount)
+
+			height = queryHeight(txSource, query, txCountMid, cfg, sLogSep)
+			if height <= blockHeightOld {
+				txCountOldUpdated = txCountMid
+				heightFound = height
+			} else {
+				txCountAbove = txCountMid
 			}
-			//
-			//stepBackUsed = stepBackUsed * 2
-			stepBackUsed = stepBackUsed + 1
 		}
 
 		if !tFound {
-			log.Println("      [WARN] we could not find blockHeight < blockHeightOld -> there has been pruning more pruning than we had retrieved in last query")
-			log.Println("             -> all available txs will bre retrived, but there are txs MISSING in the csv. You need to query an archive node to get them!")
-		} else {
-			log.Println("      [OK] txCount with blockHeight < blockHeightOld found")
+			//the node's first tx (height) is above blockHeightOld: none of its txs is in the csv yet
+			if height-1 <= blockHeightOld {
+				log.Println(sLogSep + "      [OK] the node's first tx is right after blockHeightOld -> resyncing from its first tx")
+				return 0, 0
+			}
+			//the heights in between are pruned
+			log.Println(sLogSep + "      [WARN] we could not find blockHeight < blockHeightOld -> there has been pruning more pruning than we had retrieved in last query")
+			log.Println(sLogSep + "             -> all available txs will bre retrived, but txs in heights " + strconv.Itoa(blockHeightOld+1) + "-" + strconv.Itoa(height-1) + " are MISSING in the csv, they are fetched from the archive nodes (archiveNodes in config.yaml)")
+			return 0, height - 1
 		}
+		log.Println(sLogSep + "      [OK] txCount with blockHeight < blockHeightOld found")
+		log.Println(sLogSep + "      [I] resyncing from txCount " + strconv.Itoa(txCountOldUpdated) + " (blockHeight " + strconv.Itoa(heightFound) + ")")
 
-		return txCountOldUpdated
+		return txCountOldUpdated, 0
 	}
 
 } //checkHypothesisUpdateTxCount
 
-func GetTxCountForAllRpcNodes(cfg *configData.Cfg, cfgAdr *configData.CfgAdr, chainInfos []nw.ChainInfo, chainName string) {
+// surveys the network's nodes (the fail over pool, else the chain registry's): probe (latency, sync state, earliest height,
+// tx indexing) and the tx count each reports per address; returns the scored results
+func GetTxCountForAllRpcNodes(cfg *configData.Cfg, cfgAdr *configData.CfgAdr, chainInfos []nw.ChainInfo, chainName string) []nw.NodeScore {
 	var networkIdx int
 	var addrs []string
-	//var pubKeys []string
-	//var blockHeightOld, blockHeight int
 	var txCountOld int
 	var totalCount int
-	//var ourPubKey string
-	var nodeAddr, nodeAddrPrint string
+	var nodes []string
+	var nodeScores []nw.NodeScore
 	var err error
 
 	log.Println("Querying network " + chainName + " for txCount =======================================================================")
@@ -579,147 +1521,88 @@ func GetTxCountForAllRpcNodes(cfg *configData.Cfg, cfgAdr *configData.CfgAdr, ch
 	networkIdx = slices.Index(networks, chainName)
 	if networkIdx == -1 {
 		log.Println("Skipping unknonw network:" + chainName + " not present in config")
-		return
+		return nil
 	}
+	chainI := &chainInfos[networkIdx]
 
-	//here we have a valid network; extract given addr and pubkeys as slice (for simple Contains check later on)
-	addrs = cfgAdr.GetFieldString(cfgAdrIdx, "Addr")
-	//pubKeys = cfgAdr.GetFieldString(i, "PubKey")
-
-	for _, node := range chainInfos[networkIdx].Apis.Rpc {
+	//here we have a valid network; extract given addr as slice
+	if cfgAdrIdx != -1 {
+		addrs = cfgAdr.GetFieldString(cfgAdrIdx, "Addr")
+	}
 
-		//nodeAddr = nw.EnsurePortInAddress(node.Address)
+	for _, node := range chainI.NodePool {
+		if node != "" { //the daemon's config node is also in the registry or config.yaml's nodes
+			nodes = append(nodes, node)
+		}
+	}
+	if len(nodes) == 0 {
+		for _, node := range chainI.RegistryNodes() {
+			nodes = append(nodes, nw.EnsurePortInAddress(node))
+		}
+	}
 
-		nodeAddr = nw.CheckNode(chainInfos[networkIdx].DaemonName, node.Address, true)
-		if nodeAddr == "" {
-			log.Println("      [I] node skipped (not responsive): " + node.Address) //using node.Address here as nodeAddr is empty if not responsive
+	for _, node := range nodes {
+		probe := chainI.ProbeNode(node, false) //false: pool nodes have their port already
+		nodeScore := nw.NewNodeScore(probe)
+		log.Println("      [I] node: " + node + ": " + probe.String())
+		if !probe.Responsive() {
+			nodeScores = append(nodeScores, nodeScore)
 			continue
 		}
 
 		//we need to handle each address individually, as cosmos query does not provide || for event filter (only &&)
 		//-> we can only get the txs per address individually
 		for _, ourAddr := range addrs {
-			//ourPubKey = pubKeys[j]
-
-			//log.Println("   addr: " + ourAddr)
-			//log.Println("   Checking totalCount hypothesis")
-
-			//=== get most current retrieved txs' blockheight (last line) from csv file and tx count
-			//blockHeightOld = taxcsv.GetLastBlockHeight(chainName + "_" + ourAddr + ".csv")
+			//=== tx count we have and the one the node reports (only 1 tx to get the header info)
 			txCountOld = taxcsv.GetLastTxCount(chainName + "_" + ourAddr + "_count.txt")
-
-			//=== get only 1 tx to get header info about nr of total transactions
-			totalCount, err = queryTotalCountFromNode(chainInfos[networkIdx].DaemonName, ourAddr, nodeAddr)
-			nodeAddrPrint = utils.StringExtendToLength(nodeAddr, 70)
+			totalCount, err = NewTxSourceForNode(chainI, node).TotalCount(SenderQuery(ourAddr))
+			txCount := nw.AddrTxCount{Addr: ourAddr, OurCount: txCountOld, NodeCount: totalCount}
 			if err == nil {
-				log.Println("      [I] node: txCountOld/totalCount: " + nodeAddrPrint + strconv.Itoa(txCountOld) + "/" + strconv.Itoa(totalCount))
+				log.Println("            txCountOld/totalCount: " + strconv.Itoa(txCountOld) + "/" + strconv.Itoa(totalCount) + " " + ourAddr)
 			} else {
 				//we inform that an error happened, but keep running to query other nodes
-				log.Println("      [I] node: txCountOld/totalCount: " + nodeAddrPrint + strconv.Itoa(txCountOld) + "/ error in query")
+				log.Println("            txCountOld/totalCount: " + strconv.Itoa(txCountOld) + "/ error in query " + ourAddr)
+				txCount.NodeCount = -1
+				txCount.Error = err.Error()
 			}
+			nodeScore.TxCounts = append(nodeScore.TxCounts, txCount)
 		} //for over networks addresses in cfgAdr
 
-	} // for over the rpc nodes
+		nodeScores = append(nodeScores, nodeScore)
+	} // for over the nodes
+
+	nw.ScoreNodes(nodeScores)
+	for _, nodeScore := range nodeScores {
+		log.Println("      [I] score: " + strconv.FormatFloat(nodeScore.Score, 'f', 1, 64) + " " + nodeScore.Node)
+	}
 
 	log.Println("[OK] Done querying nodes for txcount: we have / node has ==================================================================")
 
+	return nodeScores
 } //GetTxCountForAllRpcNodes
 
-// get only 1 tx to get header info about nr of total transactions
-func queryTotalCount(daemonName string, ourAddr string) int {
+// get only 1 tx to get header info about nr of total transactions; retried (queryRetrying)
+func queryTotalCount(src TxSource, query TxQuery, cfg *configData.Cfg, sLogSep string) int {
 	var totalCount int
-	var txsRespThin *TxsResp
-	var err error
-
-	txsRespThin = queryOneTx(daemonName, ourAddr, 1)
-
-	totalCount, err = strconv.Atoi(txsRespThin.TotalCount)
-	utils.ErrDefaultFatal(err) //on err log.Fatal with details
 
+	queryRetrying(src, "totalCount", cfg, sLogSep, func() (err error) {
+		totalCount, err = src.TotalCount(query)
+		return err
+	})
 	return totalCount
 }
 
-// get only 1 tx to get header info about nr of total transactions from a specific node
-func queryTotalCountFromNode(daemonName string, ourAddr string, node string) (int, error) {
-	var totalCount int
-	var txsRespThin *TxsResp
-	var err error
-
-	txsRespThin, err = queryOneTxFromNode(daemonName, ourAddr, node, 1)
-	if err != nil {
-		return 0, err
-	}
-
-	totalCount, err = strconv.Atoi(txsRespThin.TotalCount)
-	utils.ErrDefaultFatal(err) //on err log.Fatal with details
-
-	return totalCount, err
-}
-
-func queryHeight(daemonName string, ourAddr string, txCount int) int {
-	var height int
-	var txsRespThin *TxsResp
-	var err error
-
-	txsRespThin = queryOneTx(daemonName, ourAddr, txCount)
-
-	height, err = strconv.Atoi(txsRespThin.Txs[0].Height)
-	utils.ErrDefaultFatal(err)
-
-	return height
-}
-
-func queryHeightFromNode(daemonName string, ourAddr string, txCount int, node string) int {
+// the height of the tx at txCount; retried (queryRetrying)
+func queryHeight(src TxSource, query TxQuery, txCount int, cfg *configData.Cfg, sLogSep string) int {
 	var height int
-	var txsRespThin *TxsResp
-	var err error
-
-	txsRespThin, err = queryOneTxFromNode(daemonName, ourAddr, node, txCount)
-	if err != nil {
-		utils.ErrDefaultFatal(err)
-	}
-
-	height, err = strconv.Atoi(txsRespThin.Txs[0].Height)
-	utils.ErrDefaultFatal(err)
 
+	queryRetrying(src, "height of tx "+strconv.Itoa(txCount), cfg, sLogSep, func() (err error) {
+		height, err = src.HeightOfTx(query, txCount)
+		return err
+	})
 	return height
 }
 
-// get only 1 tx and unmarhsal
-func queryOneTx(daemonName string, ourAddr string, page int) *TxsResp {
-
-	txsRespThin := &TxsResp{}
-	out, err := exec.Command(daemonName, "query", "txs", "--events", "'message.sender="+ourAddr+"'", "--page", strconv.Itoa(page), "--limit", "1", "-out", "json").CombinedOutput()
-	if err != nil {
-		s := string(out)
-		err = fmt.Errorf("%w; %v", err, s)
-		utils.ErrDefaultFatal(err) //on err log.Fatal with detail
-	}
-	err = json.Unmarshal(out, &txsRespThin)
-	utils.ErrDefaultFatal(err) //on err log.Fatal with details
-
-	return txsRespThin
-}
-
-// get only 1 tx and unmarhsal
-func queryOneTxFromNode(daemonName string, ourAddr string, node string, page int) (*TxsResp, error) {
-
-	txsRespThin := &TxsResp{}
-	out, err := exec.Command(daemonName, "--node", node, "query", "txs", "--events", "'message.sender="+ourAddr+"'", "--page", strconv.Itoa(page), "--limit", "1", "-out", "json").CombinedOutput()
-
-	if err != nil {
-		s := string(out)
-		err = fmt.Errorf("%w; %v; %v", err, s, utils.FatalDetails())
-		//utils.ErrDefaultFatal(err) //on err log.Fatal with detail
-		return nil, err
-	}
-
-	err = json.Unmarshal(out, &txsRespThin)
-	utils.ErrDefaultFatal(err) //on err log.Fatal with details
-
-	return txsRespThin, nil
-}
-
 //This is similar to the standard Index function for slices, but applied
 //to our slice cfgAdr.Addresses holding the chainName in a substruct
 func indexInCfgAdr4chainName(cfgAdr *configData.CfgAdr, chainName string) int {
@@ -0,0 +1,253 @@
+package txs
+
+import (
+	"alexp/stakingtax/pkg/coins"
+	"alexp/stakingtax/pkg/configData"
+	nw "alexp/stakingtax/pkg/network"
+	"alexp/stakingtax/pkg/taxcsv"
+	"errors"
+	"io"
+	"log"
+	"os"
+	"strconv"
+	"testing"
+)
+
+// a node's txs of one query, by their heights (ascending)
+type heightsSource struct {
+	heights      []int
+	queried      []int //tx counts whose height was queried
+	pagesQueried []int
+	nFail        int //queries failing before the node answers
+}
+
+// fails the first nFail queries
+func (src *heightsSource) failing() error {
+	if src.nFail > 0 {
+		src.nFail--
+		return errors.New("node down")
+	}
+	return nil
+}
+
+func (src *heightsSource) TotalCount(query TxQuery) (int, error) {
+	if err := src.failing(); err != nil {
+		return 0, err
+	}
+	return len(src.heights), nil
+}
+
+func (src *heightsSource) HeightOfTx(query TxQuery, txCount int) (int, error) {
+	if err := src.failing(); err != nil {
+		return 0, err
+	}
+	src.queried = append(src.queried, txCount)
+	if txCount < 1 || txCount > len(src.heights) {
+		return 0, errors.New("no tx returned for txCount " + strconv.Itoa(txCount))
+	}
+	return src.heights[txCount-1], nil
+}
+
+// the txs in ascending order, like the daemon
+func (src *heightsSource) Page(query TxQuery, page int, limit int) (*TxsResp, error) {
+	if err := src.failing(); err != nil {
+		return nil, err
+	}
+	src.pagesQueried = append(src.pagesQueried, page)
+	pageTotal := (len(src.heights) + limit - 1) / limit
+	txsResp := &TxsResp{TotalCount: strconv.Itoa(len(src.heights)), PageNumber: strconv.Itoa(page), PageTotal: strconv.Itoa(pageTotal)}
+	for i := (page - 1) * limit; i < page*limit && i < len(src.heights); i++ {
+		txsResp.Txs = append(txsResp.Txs, TxResp{Height: strconv.Itoa(src.heights[i]), TxHash: "TX" + strconv.Itoa(i+1)})
+	}
+	return txsResp, nil
+}
+
+func (src *heightsSource) EarliestHeight() (int, error) {
+	return 1, nil
+}
+
+func (src *heightsSource) AccountPubKey(addr string) (string, error) {
+	return "", nil
+}
+
+// heights 10, 20, ... n*10
+func everyTen(n int) []int {
+	heights := make([]int, n)
+	for i := range heights {
+		heights[i] = (i + 1) * 10
+	}
+	return heights
+}
+
+func TestCheckHypothesisUpdateTxCount(t *testing.T) {
+	cfg := &configData.Cfg{}
+	cfg.Query.TxStepBack = 1
+
+	log.SetOutput(io.Discard)
+	defer log.SetOutput(os.Stderr)
+
+	tests := []struct {
+		name           string
+		heights        []int
+		txCountOld     int
+		blockHeightOld int
+		wantTxCount    int
+		wantGapTo      int
+		wantQueried    []int
+	}{
+		{"no new txs", everyTen(5), 5, 50, 5, 0, nil},
+		{"only new txs", everyTen(8), 5, 50, 5, 0, []int{5}},
+		{"pruned formerly, new txs", everyTen(8), 3, 50, 3, 0, []int{3}},
+		//the node pruned txs we have: our last one moved to a lower count
+		{"pruned down to our last tx", []int{30, 40, 50, 60}, 6, 60, 4, 0, nil},
+		{"found on the first probe", []int{30, 40, 50, 60, 70}, 6, 60, 4, 0, []int{4}},
+		{"more pruned, found on the first probe", []int{30, 40, 50, 60, 70}, 5, 60, 4, 0, []int{4}},
+		{"found after doubling", everyTen(20), 30, 120, 12, 0, []int{19, 17, 13, 5, 9, 11, 12}},
+		{"bisect: last of several txs at our height", []int{10, 20, 20, 20, 30, 40, 50, 60, 70, 80}, 12, 20, 4, 0, []int{9, 7, 3, 5, 4}},
+		{"bisect: our height between two txs", []int{10, 20, 30, 40, 50, 60, 70, 80, 90, 100}, 12, 45, 4, 0, []int{9, 7, 3, 5, 4}},
+		{"stepping back to the first tx", []int{20, 30, 40, 50, 60}, 8, 20, 1, 0, []int{4, 2, 1}},
+		//none of the node's txs is at or below our height
+		{"not found: pruned", []int{50, 60, 70}, 5, 30, 0, 49, []int{2, 1}},
+		{"not found: first tx right after ours", []int{31, 60, 70}, 5, 30, 0, 0, []int{2, 1}},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			src := &heightsSource{heights: tt.heights}
+			totalCount := len(tt.heights)
+
+			txCount, gapTo := checkHypothesisUpdateTxCount(tt.txCountOld, totalCount, tt.heights[totalCount-1], tt.blockHeightOld, src, TxQuery{}, cfg, "")
+			if txCount != tt.wantTxCount || gapTo != tt.wantGapTo {
+				t.Errorf("txCount, gapTo = %d, %d; want %d, %d", txCount, gapTo, tt.wantTxCount, tt.wantGapTo)
+			}
+			if !equalInts(src.queried, tt.wantQueried) {
+				t.Errorf("queried tx counts %v, want %v", src.queried, tt.wantQueried)
+			}
+		})
+	}
+}
+
+func TestFetchRange(t *testing.T) {
+	cfg := &configData.Cfg{}
+	cfg.Query.PageLimit = 3
+	cfg.Query.Nretry = 5
+	cfg.Query.FailoverAfter = 2
+
+	log.SetOutput(io.Discard)
+	defer log.SetOutput(os.Stderr)
+
+	tests := []struct {
+		name        string
+		heights     []int
+		r           heightRange
+		nFail       int
+		tNodesLeft  bool
+		wantHeights []int
+		wantPages   []int
+		wantErr     bool
+	}{
+		//txs 1-3: page 1, 4-6: page 2, ...
+		{"starts at the page of the first tx", everyTen(20), heightRange{95, 125}, 0, false, []int{100, 110, 120}, []int{4, 5}, false},
+		{"first tx of a page", everyTen(20), heightRange{70, 90}, 0, false, []int{70, 80, 90}, []int{3, 4}, false},
+		{"several txs at the first height", []int{10, 20, 30, 40, 40, 40, 40, 50}, heightRange{40, 40}, 0, false, []int{40, 40, 40, 40}, []int{2, 3}, false},
+		{"from the first tx", everyTen(5), heightRange{1, 25}, 0, false, []int{10, 20}, []int{1}, false},
+		{"to the last tx", everyTen(5), heightRange{45, 100}, 0, false, []int{50}, []int{2}, false},
+		{"above all txs", everyTen(5), heightRange{60, 100}, 0, false, nil, nil, false},
+		{"retried", everyTen(20), heightRange{95, 125}, 3, false, []int{100, 110, 120}, []int{4, 5}, false},
+		//an other archive node takes over after failoverAfter tries
+		{"given up for the next node", everyTen(20), heightRange{95, 125}, 2, true, nil, nil, true},
+		{"given up after the retries", everyTen(20), heightRange{95, 125}, 6, false, nil, nil, true},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			src := &heightsSource{heights: tt.heights, nFail: tt.nFail}
+
+			txs, err := fetchRange(src, nw.BackendDaemon, TxQuery{}, tt.r, tt.tNodesLeft, cfg, "")
+			if (err != nil) != tt.wantErr {
+				t.Fatalf("err = %v, want an error: %v", err, tt.wantErr)
+			}
+			var heights []int
+			for i := range txs {
+				heights = append(heights, heightOf(&txs[i]))
+			}
+			if !equalInts(heights, tt.wantHeights) {
+				t.Errorf("heights %v, want %v", heights, tt.wantHeights)
+			}
+			if !equalInts(src.pagesQueried, tt.wantPages) {
+				t.Errorf("pages queried %v, want %v", src.pagesQueried, tt.wantPages)
+			}
+		})
+	}
+}
+
+func TestAllocateFee(t *testing.T) {
+	const ibcDenom = "ibc/27394FB092D2ECCD56123C74F36E4C1F926001CEADA9CA97EA622B25F41E5EB2"
+
+	tests := []struct {
+		name     string
+		fee      string //base units
+		exponent int
+		strategy string
+		weights  []string //"": no fee target
+		want     []string //fee amount per group, "" if none
+	}{
+		{"no target", "1000", 6, FeeAllocationEven, []string{"", ""}, nil},
+		{"first", "1000", 6, FeeAllocationFirst, []string{"", "5", "7"}, []string{"", "0.001", ""}},
+		{"default is first", "1000", 6, "", []string{"5", "7"}, []string{"0.001", ""}},
+		{"even", "1000", 6, FeeAllocationEven, []string{"5", "", "7", "0"}, []string{"0.000334", "", "0.000333", "0.000333"}},
+		{"proportional", "1000", 6, FeeAllocationProportional, []string{"1", "3"}, []string{"0.00025", "0.00075"}},
+		{"proportional, nothing received: even", "5", 6, FeeAllocationProportional, []string{"0", "0"}, []string{"0.000003", "0.000002"}},
+		{"proportional, 18 decimals", "1000000000000000001", 18, FeeAllocationProportional, []string{"0.000000000000000001", "0.000000000000000002"},
+			[]string{"0.333333333333333334", "0.666666666666666667"}},
+		{"even, 18 decimals", "100000000000000000", 18, FeeAllocationEven, []string{"1", "1", "1"},
+			[]string{"0.033333333333333334", "0.033333333333333333", "0.033333333333333333"}},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			var groups []*msgRowGroup
+			for _, w := range tt.weights {
+				weight, _ := coins.NewDecFromString(w)
+				groups = append(groups, &msgRowGroup{rows: []*taxcsv.TaxCsv{{}}, tFeeTarget: w != "", weight: weight})
+			}
+			fee, _ := coins.NewDecFromString(tt.fee)
+
+			tAdded := allocateFee(groups, fee, tt.strategy, tt.exponent, ibcDenom)
+			if tAdded != (tt.want != nil) {
+				t.Fatalf("allocateFee() = %v, want %v", tAdded, tt.want != nil)
+			}
+
+			sum := coins.Dec{}
+			for i, group := range groups {
+				row := group.rows[0]
+				got := ""
+				if row.FeeCurrency != "" {
+					got = row.FeeAmount.String()
+				}
+				if tt.want != nil && got != tt.want[i] {
+					t.Errorf("group %d: fee %q, want %q", i, got, tt.want[i])
+				}
+				if row.FeeCurrency != "" && row.FeeCurrency != ibcDenom {
+					t.Errorf("group %d: fee currency %s", i, row.FeeCurrency)
+				}
+				sum = sum.Add(row.FeeAmount)
+			}
+			if tAdded && sum.Shift(tt.exponent).String() != tt.fee {
+				t.Errorf("shares add up to %s base units, want %s", sum.Shift(tt.exponent), tt.fee)
+			}
+		})
+	}
+}
+
+func equalInts(a []int, b []int) bool {
+	if len(a) != len(b) {
+		return false
+	}
+	for i := range a {
+		if a[i] != b[i] {
+			return false
+		}
+	}
+	return true
+}
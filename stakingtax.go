@@ -7,7 +7,9 @@ import (
 	nw "alexp/stakingtax/pkg/network"
 	"alexp/stakingtax/pkg/txs"
 	"flag"
+	"fmt"
 	"log"
+	"strings"
 )
 
 //config flags from command line
@@ -17,6 +19,11 @@ type Cfl struct {
 	tHelp          bool
 	tCheckOnly     bool
 	tQueryRpcNodes bool
+	nodesOut       string
+	deriveAddr     string
+	deriveNetworks string
+	tImportKeys    bool
+	keyringBackend string
 }
 
 // logger configured to emit app name, line number, timestamps etc.
@@ -47,10 +54,28 @@ func main() {
 
 	//=== read config file
 	config.GetConfigFromFile(cfl.configPathFile, cfg)
+
+	//=== only print addr.yaml entries of an address for other networks
+	if cfl.deriveAddr != "" {
+		chainNames := cfg.GetNetworksFieldString("Name")
+		if cfl.deriveNetworks != "" {
+			chainNames = strings.Split(cfl.deriveNetworks, ",")
+		}
+		fmt.Print(nw.DeriveAddrEntries(cfg, cfl.deriveAddr, chainNames))
+		return
+	}
+
+	//=== only merge the addresses of the daemons' keyrings into the address file
+	if cfl.tImportKeys {
+		config.MergeAddrsIntoFile(cfl.addrPathFile, nw.KeyringAddrEntries(cfg, cfl.keyringBackend))
+		return
+	}
+
 	config.GetAddrFromFile(cfl.addrPathFile, cfgAdr)
 
 	//=== check for all networks: version, rpc endpoints etc.
-	chainInfos := nw.CheckNetworks(cfg)
+	chainInfos := nw.CheckNetworks(cfg, cfgAdr)
+	nw.CheckAddresses(cfgAdr, chainInfos)
 
 	if cfl.tCheckOnly {
 		log.Println("Check networks only done.")
@@ -58,8 +83,18 @@ func main() {
 	}
 
 	if cfl.tQueryRpcNodes {
+		surveys := map[string][]nw.NodeScore{}
 		for _, v := range chainInfos {
-			txs.GetTxCountForAllRpcNodes(cfg, cfgAdr, chainInfos, v.ChainName)
+			if nodeScores := txs.GetTxCountForAllRpcNodes(cfg, cfgAdr, chainInfos, v.ChainName); nodeScores != nil {
+				surveys[v.ChainName] = nodeScores
+			}
+		}
+		//the scores are used by later runs to choose and order the nodes
+		if len(surveys) > 0 {
+			nw.SaveNodeScores(nw.NodeScoresFile, surveys)
+		}
+		if cfl.nodesOut != "" {
+			nw.WriteNodeSurvey(cfl.nodesOut, surveys)
 		}
 		log.Println("Querying RPC nodes done.")
 		return
@@ -78,5 +113,10 @@ func initFlags(cfl *Cfl) {
 	flag.StringVar(&cfl.addrPathFile, "addrPathFile", "./addr.yaml", "name (and path) of file holding the addresses to scan for tax relevant txs")
 	flag.BoolVar(&cfl.tCheckOnly, "checkOnly", false, "only check/update the networks configuration")
 	flag.BoolVar(&cfl.tQueryRpcNodes, "queryRpcNodes", false, "only query the RPC nodes for their number of relevant txs")
+	flag.StringVar(&cfl.nodesOut, "nodesOut", "", "queryRpcNodes: also write the node survey to this file (.json or .csv)")
+	flag.StringVar(&cfl.deriveAddr, "deriveAddr", "", "only print addr.yaml entries of this address for the networks sharing its coin type (see deriveNetworks)")
+	flag.StringVar(&cfl.deriveNetworks, "deriveNetworks", "", "comma separated chain registry names for deriveAddr, e.g. cosmoshub,osmosis,juno (default: the networks in config)")
+	flag.BoolVar(&cfl.tImportKeys, "importKeys", false, "only merge the addresses (and pubkeys) of each network's daemon keyring ('keys list', public data only) into the address file")
+	flag.StringVar(&cfl.keyringBackend, "keyringBackend", "", "keyring backend for importKeys (os, file, test, ...; default: the daemon's)")
 
 }